@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kayrus/gof5/pkg/client"
+	"github.com/kayrus/gof5/pkg/config"
+)
+
+const configUsage = "usage: gof5 config check | gof5 config print [--effective] [--profile name]"
+
+func configCommand(opts *client.Options, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf(configUsage)
+	}
+
+	fs := flag.NewFlagSet("config "+args[0], flag.ExitOnError)
+	switch args[0] {
+	case "check":
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		profiles, err := config.Check(opts.ConfigPath, opts.Flags)
+		if err != nil {
+			return err
+		}
+		if len(profiles) > 0 {
+			fmt.Printf("Config is valid, checked profiles: %s\n", strings.Join(profiles, ", "))
+			return nil
+		}
+		fmt.Println("Config is valid")
+		return nil
+	case "print":
+		effective := fs.Bool("effective", false, "Print the config merged with the profile, environment variables and CLI flags")
+		profile := fs.String("profile", "", "Connection profile name")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		return config.Print(os.Stdout, opts.ConfigPath, *profile, opts.Flags, *effective)
+	}
+
+	return fmt.Errorf(configUsage)
+}
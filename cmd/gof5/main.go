@@ -4,11 +4,14 @@ import (
 	"bufio"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"runtime"
+	"strconv"
 
 	"github.com/kayrus/gof5/pkg/client"
+	"github.com/kayrus/gof5/pkg/config"
+	"github.com/kayrus/gof5/pkg/logging"
 )
 
 var (
@@ -20,28 +23,22 @@ func fatal(err error) {
 	if runtime.GOOS == "windows" {
 		// Escalated privileges in windows opens a new terminal, and if there is an
 		// error, it is impossible to see it. Thus we wait for user to press a button.
-		log.Printf("%s, press enter to exit", err)
+		slog.Error(err.Error() + ", press enter to exit")
 		bufio.NewReader(os.Stdin).ReadBytes('\n')
 		os.Exit(1)
 	}
-	log.Fatal(err)
+	slog.Error(err.Error())
+	os.Exit(1)
 }
 
 func main() {
 	var version bool
-	var opts client.Options
+	opts := client.Options{
+		Flags: make(map[string]string),
+	}
 
-	flag.StringVar(&opts.Server, "server", "", "")
-	flag.StringVar(&opts.Username, "username", "", "")
-	flag.StringVar(&opts.Password, "password", "", "")
-	flag.StringVar(&opts.SessionID, "session", "", "Reuse a session ID")
-	flag.StringVar(&opts.CACert, "ca-cert", "", "Path to a custom CA certificate")
-	flag.StringVar(&opts.Cert, "cert", "", "Path to a user TLS certificate")
-	flag.StringVar(&opts.Key, "key", "", "Path to a user TLS key")
-	flag.BoolVar(&opts.CloseSession, "close-session", false, "Close HTTPS VPN session on exit")
-	flag.BoolVar(&opts.Debug, "debug", false, "Show debug logs")
-	flag.BoolVar(&opts.Sel, "select", false, "Select a server from available F5 servers")
-	flag.IntVar(&opts.ProfileIndex, "profile-index", 0, "If multiple VPN profiles are found chose profile n")
+	config.RegisterFlags(flag.CommandLine, opts.Flags)
+	flag.StringVar(&opts.ConfigPath, "config", "", "Path to a config file, ~/.gof5/config.yaml by default (env GOF5_CONFIG), the ~/.gof5 directory is set by GOF5_HOME")
 	flag.BoolVar(&version, "version", false, "Show version and exit cleanly")
 
 	flag.Parse()
@@ -51,19 +48,61 @@ func main() {
 		os.Exit(0)
 	}
 
-	if opts.ProfileIndex < 0 {
-		fatal(fmt.Errorf("profile-index cannot be negative"))
+	// the config file settings are applied after the config is read
+	debug, _ := strconv.ParseBool(config.Lookup("debug", opts.Flags))
+	if err := logging.Setup(os.Stderr, config.Lookup("logFormat", opts.Flags), config.Lookup("logLevel", opts.Flags), debug); err != nil {
+		fatal(err)
 	}
 
-	log.Print(info)
+	// config commands don't require privileges
+	if flag.Arg(0) == "config" {
+		if err := configCommand(&opts, flag.Args()[1:]); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	slog.Info(info)
 
 	if err := checkPermissions(); err != nil {
 		fatal(err)
 	}
 
 	if flag.NArg() > 0 {
-		if err := client.UrlHandlerF5Vpn(&opts, flag.Arg(0)); err != nil {
-			fatal(err)
+		switch flag.Arg(0) {
+		case "cleanup":
+			// remove leftovers of a crashed or failed gof5 process
+			if err := client.Cleanup(&opts); err != nil {
+				fatal(err)
+			}
+			return
+		case "exec":
+			// run a command inside the tunnel network namespace
+			args := flag.Args()[1:]
+			if len(args) > 0 && args[0] == "--" {
+				args = args[1:]
+			}
+			if len(args) == 0 {
+				fatal(fmt.Errorf("command is required: gof5 --netns <name> exec -- <cmd>"))
+			}
+			if err := client.Exec(&opts, args); err != nil {
+				fatal(err)
+			}
+			return
+		case "connect":
+			// connect using a named profile from the config
+			if flag.NArg() < 2 {
+				fatal(fmt.Errorf("profile name is required: gof5 connect <name>"))
+			}
+			opts.Profile = flag.Arg(1)
+			// parse flags, defined after the profile name
+			if err := flag.CommandLine.Parse(flag.Args()[2:]); err != nil {
+				fatal(err)
+			}
+		default:
+			if err := client.UrlHandlerF5Vpn(&opts, flag.Arg(0)); err != nil {
+				fatal(err)
+			}
 		}
 	}
 
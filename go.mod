@@ -4,7 +4,6 @@ go 1.25.0
 
 require (
 	github.com/IBM/netaddr v1.5.0
-	github.com/fatih/color v1.10.0
 	github.com/howeyc/gopass v0.0.0-20190910152052-7cb4b85ec19c
 	github.com/hpcloud/tail v1.0.0
 	github.com/kayrus/tuncfg v0.0.0-20211029100448-15eab7b00382
@@ -12,6 +11,8 @@ require (
 	github.com/miekg/dns v1.1.40
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/pion/dtls/v2 v2.2.4
+	github.com/vishvananda/netlink v1.1.0
+	github.com/vishvananda/netns v0.0.0-20191106174202-0a2b9b5464df
 	github.com/zaninime/go-hdlc v1.1.1
 	golang.org/x/net v0.55.0
 	golang.org/x/sys v0.45.0
@@ -32,8 +33,6 @@ require (
 	github.com/pion/udp v0.1.4 // indirect
 	github.com/sigurn/crc16 v0.0.0-20160107003519-da416fad5162 // indirect
 	github.com/sigurn/utils v0.0.0-20151230205143-f19e41f79f8f // indirect
-	github.com/vishvananda/netlink v1.1.0 // indirect
-	github.com/vishvananda/netns v0.0.0-20191106174202-0a2b9b5464df // indirect
 	golang.org/x/crypto v0.52.0 // indirect
 	golang.org/x/term v0.43.0 // indirect
 	golang.zx2c4.com/wireguard v0.0.0-20211028114750-eb6302c7eb71 // indirect
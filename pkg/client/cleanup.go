@@ -0,0 +1,41 @@
+package client
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/kayrus/gof5/pkg/config"
+	"github.com/kayrus/gof5/pkg/firewall"
+	"github.com/kayrus/gof5/pkg/journal"
+)
+
+// Cleanup removes the leftovers of a previous gof5 run, which could not
+// restore the system config, e.g. the kill switch after the tunnel failure
+// or routes and DNS settings after the process was killed. The firewall
+// rules are removed first, even when the config cannot be read, otherwise
+// the host may stay without network access.
+func Cleanup(opts *Options) error {
+	var errs []error
+
+	slog.Info("Removing kill switch")
+	if err := firewall.RemoveKillSwitch(); err != nil {
+		errs = append(errs, err)
+	}
+
+	slog.Info("Removing DNS leak protection")
+	if err := firewall.RemoveDNSLeakProtection(); err != nil {
+		errs = append(errs, err)
+	}
+
+	cfg, err := config.ReadConfig(opts.ConfigPath, opts.Profile, opts.Flags)
+	if err != nil {
+		errs = append(errs, err)
+		return errors.Join(errs...)
+	}
+
+	if err := journal.Replay(cfg.Path); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
@@ -1,40 +1,55 @@
 package client
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
-	"net/http/cookiejar"
 	"net/url"
 	"os"
 	"os/signal"
 	"runtime"
 	"syscall"
+	"time"
 
 	"github.com/kayrus/gof5/pkg/config"
 	"github.com/kayrus/gof5/pkg/cookie"
+	"github.com/kayrus/gof5/pkg/firewall"
+	"github.com/kayrus/gof5/pkg/journal"
 	"github.com/kayrus/gof5/pkg/link"
+	"github.com/kayrus/gof5/pkg/logging"
+	"github.com/kayrus/gof5/pkg/metrics"
+	"github.com/kayrus/gof5/pkg/pcap"
+)
+
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 30 * time.Second
 )
 
 type Options struct {
 	config.Config
-	Server        string
-	Username      string
-	Password      string
-	SessionID     string
-	CACert        string
-	Cert          string
-	Key           string
-	CloseSession  bool
-	Debug         bool
-	Sel           bool
-	Version       bool
-	ProfileIndex  int
-	ProfileName   string
+	// config file path, ~/.gof5/config.yaml by default
+	ConfigPath string
+	// gof5 connection profile name
+	Profile string
+	// explicitly set CLI flags, they override the config file settings
+	Flags         map[string]string
 	Renegotiation tls.RenegotiationSupport
+	// TUN, routes and DNS handlers, link.SystemBackend is used, when nil
+	Backend *link.Backend
+}
+
+// Set sets an option value with the CLI flag priority
+func (o *Options) Set(name, value string) {
+	if o.Flags == nil {
+		o.Flags = make(map[string]string)
+	}
+	o.Flags[name] = value
 }
 
 func UrlHandlerF5Vpn(opts *Options, s string) error {
@@ -57,14 +72,15 @@ func UrlHandlerF5Vpn(opts *Options, s string) error {
 	if len(resourceTypes) == len(resourceNames) {
 		for i := range resourceTypes {
 			if resourceTypes[i] == "network_access" {
-				opts.ProfileName = resourceNames[i]
+				opts.Set("vpnProfile", resourceNames[i])
 				break
 			}
 		}
 	}
 
-	opts.Server = m["server"][0]
-	tokenUrl := fmt.Sprintf("%s://%s:%s/vdesk/get_sessid_for_token.php3", m["protocol"][0], opts.Server, m["port"][0])
+	server := m["server"][0]
+	opts.Set("server", server)
+	tokenUrl := fmt.Sprintf("%s://%s:%s/vdesk/get_sessid_for_token.php3", m["protocol"][0], server, m["port"][0])
 	request, err := http.NewRequest(http.MethodGet, tokenUrl, nil)
 	if err != nil {
 		return err
@@ -78,11 +94,22 @@ func UrlHandlerF5Vpn(opts *Options, s string) error {
 		return err
 	}
 
-	opts.SessionID = response.Header.Get("X-Access-Session-ID")
+	opts.Set("sessionID", response.Header.Get("X-Access-Session-ID"))
 	return nil
 }
 
 func Connect(opts *Options) error {
+	// read config
+	cfg, err := config.ReadConfig(opts.ConfigPath, opts.Profile, opts.Flags)
+	if err != nil {
+		return err
+	}
+	opts.Config = *cfg
+
+	if err = logging.Setup(os.Stderr, cfg.LogFormat, cfg.LogLevel, cfg.Debug); err != nil {
+		return err
+	}
+
 	if opts.Server == "" {
 		fmt.Print("Enter server address: ")
 		fmt.Scanln(&opts.Server)
@@ -109,12 +136,10 @@ func Connect(opts *Options) error {
 	}
 	opts.Server = u.Host
 
-	// read config
-	cfg, err := config.ReadConfig(opts.Debug)
-	if err != nil {
+	// restore the system config, left by a killed gof5 process
+	if err := journal.Replay(cfg.Path); err != nil {
 		return err
 	}
-	opts.Config = *cfg
 
 	switch cfg.Renegotiation {
 	case "RenegotiateOnceAsClient":
@@ -127,7 +152,7 @@ func Connect(opts *Options) error {
 		return fmt.Errorf("unknown renegotiation value: '%s'", cfg.Renegotiation)
 	}
 
-	cookieJar, err := cookiejar.New(nil)
+	cookieJar, err := cookie.NewJar()
 	if err != nil {
 		return fmt.Errorf("failed to create cookie jar: %s", err)
 	}
@@ -142,7 +167,7 @@ func Connect(opts *Options) error {
 	transport := &http.Transport{
 		TLSClientConfig: tlsConf,
 	}
-	if opts.Debug {
+	if httpLog.Enabled(context.Background(), slog.LevelDebug) {
 		client.Transport = &RoundTripper{
 			Rt:     transport,
 			Logger: &logger{},
@@ -152,7 +177,7 @@ func Connect(opts *Options) error {
 	}
 
 	// when server select list has been chosen
-	if opts.Sel {
+	if opts.Select {
 		u, err = getServersList(client, opts.Server)
 		if err != nil {
 			return err
@@ -169,7 +194,7 @@ func Connect(opts *Options) error {
 			return fmt.Errorf("failed to login: %s", err)
 		}
 	} else {
-		log.Printf("Reusing saved HTTPS VPN session for %s", u.Host)
+		slog.Info("Reusing saved HTTPS VPN session", "server", u.Host)
 	}
 
 	resp, err := getProfiles(client, opts.Server)
@@ -200,7 +225,7 @@ func Connect(opts *Options) error {
 		return fmt.Errorf("wrong response code on profiles get: %d", resp.StatusCode)
 	}
 
-	profile, err := parseProfile(resp.Body, opts.ProfileIndex, opts.ProfileName)
+	profile, err := parseProfile(resp.Body, opts.VPNProfileIndex, opts.VPNProfile)
 	if err != nil {
 		return fmt.Errorf("failed to parse VPN profiles: %s", err)
 	}
@@ -222,21 +247,131 @@ func Connect(opts *Options) error {
 		defer closeVPNSession(client, opts.Server)
 	}
 
+	serverIPs, err := link.LookupServer(u.Hostname())
+	if err != nil {
+		return err
+	}
+
+	if cfg.MetricsListen != "" {
+		if err := metrics.Serve(cfg.MetricsListen); err != nil {
+			return err
+		}
+	}
+
+	s := &session{
+		opts:      opts,
+		cfg:       cfg,
+		serverIPs: serverIPs,
+		tlsConf:   tlsConf,
+	}
+
+	if cfg.Pcap != "" {
+		interfaces := []pcap.Interface{{Name: "tun", LinkType: pcap.LinkTypeRaw}}
+		if cfg.PcapPPP {
+			interfaces = append(interfaces, pcap.Interface{Name: "f5", LinkType: pcap.LinkTypePPP})
+		}
+		s.capture, err = pcap.Create(cfg.Pcap, interfaces...)
+		if err != nil {
+			return err
+		}
+		defer s.capture.Close()
+		// allow to open the capture file without root privileges
+		if runtime.GOOS != "windows" {
+			if err := os.Chown(cfg.Pcap, cfg.Uid, cfg.Gid); err != nil {
+				return fmt.Errorf("failed to set an owner for the capture file: %s", err)
+			}
+		}
+		slog.Info("Capturing tunnel packets", "file", cfg.Pcap)
+	}
+
+	s.termChan = make(chan os.Signal, 1)
+	signal.Notify(s.termChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGPIPE)
+	// SIGHUP reloads routes and DNS settings
+	s.hupChan = make(chan os.Signal, 1)
+	signal.Notify(s.hupChan, syscall.SIGHUP)
+
+	delay := minReconnectDelay
+	for {
+		err = s.tunnel()
+		if err == nil || !cfg.Reconnect {
+			break
+		}
+
+		slog.Warn("Tunnel is down, reconnecting", "err", err, "delay", delay)
+		select {
+		case sig := <-s.termChan:
+			slog.Info("Received signal, exiting", "signal", sig)
+			err = nil
+		case <-time.After(delay):
+			if delay *= 2; delay > maxReconnectDelay {
+				delay = maxReconnectDelay
+			}
+			metrics.IncReconnects()
+			s.reconnects++
+			continue
+		}
+		break
+	}
+
+	if s.killSwitch {
+		if err != nil {
+			slog.Warn("Kill switch stays enabled, run \"gof5 cleanup\" to remove it")
+			return err
+		}
+		slog.Info("Disabling kill switch")
+		if err := firewall.RemoveKillSwitch(); err != nil {
+			slog.Error("Failed to disable kill switch", "err", err)
+		} else if err := journal.Forget(cfg.Path, journal.KillSwitch, ""); err != nil {
+			slog.Error("Failed to update journal", "err", err)
+		}
+	}
+
+	return err
+}
+
+// session holds the tunnel parameters, which are kept between reconnects
+type session struct {
+	opts      *Options
+	cfg       *config.Config
+	serverIPs []net.IP
+	tlsConf   *tls.Config
+	capture   *pcap.Writer
+	termChan  chan os.Signal
+	hupChan   chan os.Signal
+	// number of reconnect attempts
+	reconnects int
+	// the kill switch was enabled by one of the tunnels
+	killSwitch bool
+}
+
+// tunnel establishes a VPN tunnel and serves it until a termination signal
+// or an error is received
+func (s *session) tunnel() error {
+	opts, cfg := s.opts, s.cfg
+
 	// TLS
-	l, err := link.InitConnection(opts.Server, cfg, tlsConf)
+	l, err := link.InitConnection(opts.Server, s.serverIPs, cfg, s.tlsConf)
 	if err != nil {
 		return err
 	}
 	defer l.HTTPConn.Close()
+	l.Pcap = s.capture
+	if opts.Backend != nil {
+		l.Backend = *opts.Backend
+	}
+	l.Reconnected = s.reconnects > 0
 
 	cmd := link.Cmd(cfg)
 
-	termChan := make(chan os.Signal, 1)
-	signal.Notify(termChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGPIPE, syscall.SIGHUP)
-
 	// set routes and DNS after the PPP/TUN is up
 	go l.WaitAndConfig(cfg)
 
+	// 2. the kill switch is kept between reconnects
+	defer func() {
+		if l.KillSwitch() {
+			s.killSwitch = true
+		}
+	}()
 	// 1. stop ppp/pppd child at the very end
 	defer l.StopPPPDChild(cmd)
 	// 0. restore the config first
@@ -288,15 +423,36 @@ func Connect(opts *Options) error {
 
 		// tun->http go routine
 		go l.TunToHTTP()
+
+		// coalesced frames writer go routine
+		go l.FlushToHTTP()
+
+		// LCP echo RTT measurement
+		if cfg.MetricsListen != "" {
+			go l.LCPEcho()
+		}
 	}
 
-	select {
-	case sig := <-termChan:
-		log.Printf("received %s signal, exiting", sig)
-	case err = <-l.ErrChan:
-		// error received
-	case err = <-l.PppdErrChan:
-		// ppp/pppd child error received
+	for {
+		select {
+		case sig := <-s.termChan:
+			slog.Info("Received signal, exiting", "signal", sig)
+		case <-s.hupChan:
+			slog.Info("Received SIGHUP signal, reloading config")
+			newCfg, err := config.ReadConfig(opts.ConfigPath, opts.Profile, opts.Flags)
+			if err == nil {
+				err = l.Reload(cfg, newCfg)
+			}
+			if err != nil {
+				slog.Error("Failed to reload config", "err", err)
+			}
+			continue
+		case err = <-l.ErrChan:
+			// error received
+		case err = <-l.PppdErrChan:
+			// ppp/pppd child error received
+		}
+		break
 	}
 
 	// notify tun readers and writes to stop
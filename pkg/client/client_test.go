@@ -0,0 +1,181 @@
+package client
+
+import (
+	"bytes"
+	"encoding/pem"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kayrus/gof5/pkg/f5test"
+	"github.com/kayrus/gof5/pkg/link"
+
+	"golang.org/x/net/ipv4"
+)
+
+func ipPacket(t *testing.T, src, dst net.IP, payload string) []byte {
+	h := &ipv4.Header{
+		Version:  ipv4.Version,
+		Len:      ipv4.HeaderLen,
+		TotalLen: ipv4.HeaderLen + len(payload),
+		TTL:      64,
+		Protocol: 17,
+		Src:      src,
+		Dst:      dst,
+	}
+	b, err := h.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(b, payload...)
+}
+
+func receive(t *testing.T, c chan []byte) []byte {
+	select {
+	case v := <-c:
+		return v
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for a packet")
+	}
+	return nil
+}
+
+func TestConnect(t *testing.T) {
+	srv := f5test.NewServer()
+	defer srv.Close()
+
+	dir := t.TempDir()
+	t.Setenv("GOF5_HOME", dir)
+
+	caCert := filepath.Join(dir, "ca.pem")
+	err := os.WriteFile(caCert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfgPath := filepath.Join(dir, "config.yaml")
+	err = os.WriteFile(cfgPath, []byte("closeSession: true\nroutes:\n- 10.0.0.0/8\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := &f5test.Events{}
+	dev := f5test.NewTun("tun0")
+	dev.Events = events
+	opts := &Options{
+		ConfigPath: cfgPath,
+		Backend: &link.Backend{
+			OpenTun: func(_, _ *net.IPNet, _ string, _ int) (link.Device, error) {
+				events.Add("tun open")
+				return dev, nil
+			},
+			NewRouter: func(_ string, routes []*net.IPNet, _ net.IP) (link.Router, error) {
+				return &f5test.Router{Events: events, Routes: routes}, nil
+			},
+			NewResolver: func(_ string, servers []net.IP, _ []string, _ bool) (link.Resolver, error) {
+				return &f5test.Resolver{Events: events, DNSServers: servers}, nil
+			},
+		},
+	}
+	opts.Set("server", srv.URL)
+	opts.Set("username", srv.Username)
+	opts.Set("password", srv.Password)
+	opts.Set("caCert", caCert)
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- Connect(opts)
+	}()
+
+	var tunnel *f5test.Tunnel
+	select {
+	case tunnel = <-srv.Tunnels:
+	case err := <-errChan:
+		t.Fatalf("failed to connect: %v", err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the tunnel")
+	}
+
+	select {
+	case <-tunnel.Up:
+	case <-tunnel.Done:
+		t.Fatalf("PPP negotiation failed: %v", tunnel.Err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the PPP negotiation")
+	}
+
+	// local application -> F5
+	out := ipPacket(t, srv.ClientIP, net.IPv4(10, 0, 0, 1), "ping")
+	dev.Inject(out)
+	if v := receive(t, tunnel.Packets); !bytes.Equal(v, out) {
+		t.Errorf("F5 received %x, expected %x", v, out)
+	}
+
+	// F5 -> local application
+	in := ipPacket(t, net.IPv4(10, 0, 0, 1), srv.ClientIP, "pong")
+	if err := tunnel.Send(in); err != nil {
+		t.Fatal(err)
+	}
+	if v := receive(t, dev.Packets); !bytes.Equal(v, in) {
+		t.Errorf("TUN received %x, expected %x", v, in)
+	}
+
+	if err := tunnel.Terminate(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err = <-errChan:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the disconnect")
+	}
+	if err == nil || !strings.Contains(err.Error(), "Link terminated") {
+		t.Errorf("expected link termination error, got: %v", err)
+	}
+
+	requests := strings.Join(srv.Requests(), " ")
+	for _, v := range []string{"/my.policy", "/vdesk/vpn/index.php3", "/vdesk/vpn/connect.php3", "/myvpn", "/vdesk/hangup.php3"} {
+		if !strings.Contains(requests, v) {
+			t.Errorf("%s was not requested: %s", v, requests)
+		}
+	}
+
+	expected := []string{
+		"tun open",
+		"resolv set [10.0.0.53]",
+		"route add [10.0.0.0/8]",
+		"route del [10.0.0.0/8]",
+		"resolv restore",
+		"tun close",
+	}
+	if v := events.List(); strings.Join(v, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected system changes:\n%s\nexpected:\n%s", strings.Join(v, "\n"), strings.Join(expected, "\n"))
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "cookies.yaml")); err != nil {
+		t.Errorf("cookies were not saved: %v", err)
+	}
+}
+
+func TestUrlHandlerF5Vpn(t *testing.T) {
+	srv := f5test.NewUnstartedServer()
+	srv.Start()
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	opts := &Options{}
+	err := UrlHandlerF5Vpn(opts, "f5-vpn://"+u.Host+"/?server="+u.Hostname()+"&port="+u.Port()+
+		"&protocol=http&resourcetype=network_access&resourcename=/Common/vpn&otc="+srv.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := opts.Flags["sessionID"]; v != srv.SessionID {
+		t.Errorf("session ID is %q, expected %q", v, srv.SessionID)
+	}
+	if v := opts.Flags["vpnProfile"]; v != "/Common/vpn" {
+		t.Errorf("VPN profile is %q, expected /Common/vpn", v)
+	}
+}
@@ -0,0 +1,23 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/kayrus/gof5/pkg/config"
+	"github.com/kayrus/gof5/pkg/link"
+)
+
+// Exec runs the command inside the network namespace, configured by the
+// netns option, the function returns only on error
+func Exec(opts *Options, args []string) error {
+	cfg, err := config.ReadConfig(opts.ConfigPath, opts.Profile, opts.Flags)
+	if err != nil {
+		return err
+	}
+
+	if cfg.Netns == "" {
+		return fmt.Errorf("network namespace is not configured, use the netns option")
+	}
+
+	return link.ExecNetns(cfg.Netns, args)
+}
@@ -12,15 +12,15 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
-	"net/http/cookiejar"
 	"net/url"
 	"os"
 	"regexp"
 	"strings"
 
 	"github.com/kayrus/gof5/pkg/config"
+	"github.com/kayrus/gof5/pkg/cookie"
 
 	"github.com/howeyc/gopass"
 	"github.com/manifoldco/promptui"
@@ -98,7 +98,7 @@ func checkRedirect(c *http.Client) func(*http.Request, []*http.Request) error {
 		if req.URL.Path == "/my.logout.php3" || req.URL.Path == "/vdesk/hangup.php3" || req.URL.Query().Get("errorcode") != "" {
 			// clear cookies
 			var err error
-			c.Jar, err = cookiejar.New(nil)
+			c.Jar, err = cookie.NewJar()
 			if err != nil {
 				return fmt.Errorf("failed to create cookie jar: %s", err)
 			}
@@ -152,7 +152,7 @@ func generateClientData(cData config.ClientData) (string, error) {
 }
 
 func loginSignature(c *http.Client, server string, _, _ *string) error {
-	log.Printf("Logging in...")
+	slog.Info("Logging in")
 	req, err := http.NewRequest("GET", fmt.Sprintf("https://%s/my.logon.php3?outform=xml&client_version=2.0&get_token=1", server), nil)
 	if err != nil {
 		return err
@@ -228,7 +228,7 @@ func login(c *http.Client, server string, username, password *string) error {
 		*password = string(v)
 	}
 
-	log.Printf("Logging in...")
+	slog.Info("Logging in")
 	req, err := http.NewRequest("GET", fmt.Sprintf("https://%s", server), nil)
 	if err != nil {
 		return err
@@ -296,12 +296,12 @@ func parseProfile(reader io.ReadCloser, profileIndex int, profileName string) (s
 			}
 			prfls[i] = fmt.Sprintf("%d:%s", i, p.Name)
 		}
-		log.Printf("Found F5 VPN profiles: %q", prfls)
+		slog.Info("Found F5 VPN profiles", "profiles", prfls)
 
 		if profileIndex >= len(profiles.Favorites) {
 			return "", fmt.Errorf("profile %q index is out of range", profileIndex)
 		}
-		log.Printf("Using %q F5 VPN profile", profiles.Favorites[profileIndex].Name)
+		slog.Info("Using F5 VPN profile", "profile", profiles.Favorites[profileIndex].Name)
 		return profiles.Favorites[profileIndex].Params, nil
 	}
 
@@ -326,8 +326,8 @@ func getConnectionOptions(c *http.Client, opts *Options, profile string) (*confi
 	resp, err := c.Do(req)
 
 	if err != nil {
-		log.Printf("Failed to read a request: %s", err)
-		log.Printf("Override link DNS values from config")
+		httpLog.Warn("Failed to get VPN connection options", "err", err)
+		httpLog.Warn("Overriding link DNS values from config")
 		return &config.Favorite{
 			Object: config.Object{
 				SessionID: opts.SessionID,
@@ -364,11 +364,11 @@ func closeVPNSession(c *http.Client, server string) {
 	// close session
 	r, err := http.NewRequest("GET", fmt.Sprintf("https://%s/vdesk/hangup.php3?hangup_error=1", server), nil)
 	if err != nil {
-		log.Printf("Failed to create a request to close the VPN session %s", err)
+		httpLog.Error("Failed to create a request to close the VPN session", "err", err)
 	}
 	resp, err := c.Do(r)
 	if err != nil {
-		log.Printf("Failed to close the VPN session %s", err)
+		httpLog.Error("Failed to close the VPN session", "err", err)
 	}
 	defer resp.Body.Close()
 }
@@ -5,9 +5,10 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"strings"
+
+	"github.com/kayrus/gof5/pkg/logging"
 )
 
 // Logger is an interface representing the Logger struct
@@ -16,19 +17,23 @@ type Logger interface {
 	ResponsePrintf(format string, args ...interface{})
 }
 
+var httpLog = logging.For(logging.HTTP)
+
+// logger writes requests and responses to the http subsystem debug log, the
+// secrets are redacted by the logging handler
 type logger struct {
 	RequestID string
 }
 
 func (lg logger) RequestPrintf(format string, args ...interface{}) {
 	for _, v := range strings.Split(fmt.Sprintf(format, args...), "\n") {
-		log.Printf("-> %s", v)
+		httpLog.Debug(v, "direction", "request")
 	}
 }
 
 func (lg logger) ResponsePrintf(format string, args ...interface{}) {
 	for _, v := range strings.Split(fmt.Sprintf(format, args...), "\n") {
-		log.Printf("<- %s", v)
+		httpLog.Debug(v, "direction", "response")
 	}
 }
 
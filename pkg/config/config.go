@@ -3,16 +3,16 @@ package config
 import (
 	"fmt"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net"
 	"os"
 	"os/user"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 
-	"github.com/kayrus/gof5/pkg/util"
-
+	"github.com/mitchellh/go-homedir"
 	"gopkg.in/yaml.v2"
 )
 
@@ -28,7 +28,77 @@ var (
 	supportedDrivers        = []string{"wireguard", "pppd"}
 )
 
-func ReadConfig(debug bool) (*Config, error) {
+// mergeProfile overlays the named profile settings on top of the global
+// settings and removes the profiles list from the config
+func mergeProfile(raw []byte, profile string) (map[string]interface{}, error) {
+	var global map[string]interface{}
+	if err := yaml.Unmarshal(raw, &global); err != nil {
+		return nil, err
+	}
+
+	profiles, _ := global["profiles"].(map[interface{}]interface{})
+	delete(global, "profiles")
+
+	if profile != "" {
+		p, ok := profiles[profile]
+		if !ok {
+			var names []string
+			for k := range profiles {
+				names = append(names, fmt.Sprintf("%v", k))
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("%q profile was not found, available profiles: %q", profile, names)
+		}
+		settings, ok := p.(map[interface{}]interface{})
+		if !ok && p != nil {
+			return nil, fmt.Errorf("%q profile must be a map", profile)
+		}
+		if global == nil {
+			global = make(map[string]interface{})
+		}
+		for k, v := range settings {
+			global[fmt.Sprintf("%v", k)] = v
+		}
+	}
+
+	if global == nil {
+		global = make(map[string]interface{})
+	}
+
+	return global, nil
+}
+
+// mergeOverrides overlays the environment variables and the CLI flags on top
+// of the config file settings
+func mergeOverrides(values map[string]interface{}, flags map[string]string) error {
+	for _, o := range Options {
+		if v, ok := os.LookupEnv(o.Env()); ok {
+			t, err := o.parse(v)
+			if err != nil {
+				return fmt.Errorf("%s: %v", o.Env(), err)
+			}
+			values[o.Name] = t
+		}
+	}
+
+	for name, v := range flags {
+		o, ok := findOption(name)
+		if !ok {
+			return fmt.Errorf("unknown %q option", name)
+		}
+		t, err := o.parse(v)
+		if err != nil {
+			return err
+		}
+		values[o.Name] = t
+	}
+
+	return nil
+}
+
+// detectConfigDir detects and creates the gof5 config directory, which belongs to
+// the current user or the sudo user
+func detectConfigDir() (string, int, int, error) {
 	var err error
 	var usr *user.User
 
@@ -36,11 +106,11 @@ func ReadConfig(debug bool) (*Config, error) {
 	if id, sudoUID := os.Geteuid(), os.Getenv("SUDO_UID"); id == 0 && sudoUID != "" {
 		usr, err = user.LookupId(sudoUID)
 		if err != nil {
-			log.Printf("failed to lookup user ID: %s", err)
+			slog.Warn("Failed to lookup user ID", "err", err)
 			if sudoUser := os.Getenv("SUDO_USER"); sudoUser != "" {
 				usr, err = user.Lookup(sudoUser)
 				if err != nil {
-					return nil, fmt.Errorf("failed to lookup user name: %s", err)
+					return "", 0, 0, fmt.Errorf("failed to lookup user name: %s", err)
 				}
 			}
 		}
@@ -48,67 +118,112 @@ func ReadConfig(debug bool) (*Config, error) {
 		// detect home directory
 		usr, err = user.Current()
 		if err != nil {
-			return nil, fmt.Errorf("failed to detect home directory: %s", err)
+			return "", 0, 0, fmt.Errorf("failed to detect home directory: %s", err)
 		}
 	}
 	configPath := filepath.Join(usr.HomeDir, configDir)
+	// GOF5_HOME overrides the config directory, which contains the config
+	// file, the journal and the cookies
+	if v := os.Getenv(envPrefix + "HOME"); v != "" {
+		configPath = v
+	}
 
 	var uid, gid int
 	// windows preserves the original user parameters, no need to detect uid/gid
 	if runtime.GOOS != "windows" {
 		uid, err = strconv.Atoi(usr.Uid)
 		if err != nil {
-			return nil, fmt.Errorf("failed to convert %q UID to integer: %s", usr.Uid, err)
+			return "", 0, 0, fmt.Errorf("failed to convert %q UID to integer: %s", usr.Uid, err)
 		}
 		gid, err = strconv.Atoi(usr.Gid)
 		if err != nil {
-			return nil, fmt.Errorf("failed to convert %q GID to integer: %s", usr.Uid, err)
+			return "", 0, 0, fmt.Errorf("failed to convert %q GID to integer: %s", usr.Uid, err)
 		}
 	}
 
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		log.Printf("%q directory doesn't exist, creating...", configPath)
+		slog.Info("Creating config directory", "path", configPath)
 		if err := os.Mkdir(configPath, 0700); err != nil {
-			return nil, fmt.Errorf("failed to create %q config directory: %s", configPath, err)
+			return "", 0, 0, fmt.Errorf("failed to create %q config directory: %s", configPath, err)
 		}
 		// windows preserves the original user parameters, no need to chown
 		if runtime.GOOS != "windows" {
 			if err := os.Chown(configPath, uid, gid); err != nil {
-				return nil, fmt.Errorf("failed to set an owner for the %q config directory: %s", configPath, err)
+				return "", 0, 0, fmt.Errorf("failed to set an owner for the %q config directory: %s", configPath, err)
 			}
 		}
 	} else if err != nil {
-		return nil, fmt.Errorf("failed to get %q directory stat: %s", configPath, err)
+		return "", 0, 0, fmt.Errorf("failed to get %q directory stat: %s", configPath, err)
 	}
 
-	cfg := &Config{}
+	return configPath, uid, gid, nil
+}
+
+// configFile returns the config file path and whether it was set explicitly
+func configFile(configPath, path string) (string, bool, error) {
+	if path == "" {
+		path = os.Getenv(envPrefix + "CONFIG")
+	}
+	if path == "" {
+		return filepath.Join(configPath, configName), false, nil
+	}
+	v, err := homedir.Expand(path)
+	if err != nil {
+		return "", true, fmt.Errorf("failed to expand %q config path: %v", path, err)
+	}
+	return v, true, nil
+}
+
+// ReadConfig reads the config file, by default ~/.gof5/config.yaml, merges
+// the profile settings, environment variables and CLI flags
+func ReadConfig(path, profile string, flags map[string]string) (*Config, error) {
+	configPath, uid, gid, err := detectConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	path, explicit, err := configFile(configPath, path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]interface{})
 	// read config file
 	// if config doesn't exist, use defaults
-	if raw, err := ioutil.ReadFile(filepath.Join(configPath, configName)); err == nil {
-		if err = yaml.Unmarshal(raw, cfg); err != nil {
-			return nil, fmt.Errorf("cannot parse %s file: %v", configName, err)
+	if raw, err := ioutil.ReadFile(path); err == nil {
+		if err = checkKeys(raw); err != nil {
+			return nil, fmt.Errorf("invalid %s file:\n%v", path, err)
+		}
+		if values, err = mergeProfile(raw, profile); err != nil {
+			return nil, fmt.Errorf("cannot parse %s file: %v", path, err)
 		}
+	} else if explicit || profile != "" {
+		return nil, fmt.Errorf("cannot read config file: %s", err)
 	} else {
-		log.Printf("Cannot read config file: %s", err)
+		slog.Warn("Cannot read config file", "err", err)
 	}
 
-	// set default driver
-	if cfg.Driver == "" {
-		cfg.Driver = "wireguard"
+	if err = mergeOverrides(values, flags); err != nil {
+		return nil, err
 	}
 
-	if cfg.Driver == "wireguard" {
-		if err := checkWinTunDriver(); err != nil {
-			return nil, err
-		}
+	raw, err := yaml.Marshal(values)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal config: %v", err)
 	}
+	cfg := &Config{}
+	if err = yaml.Unmarshal(raw, cfg); err != nil {
+		return nil, fmt.Errorf("cannot parse config: %v", err)
+	}
+	cfg.Profile = profile
 
-	if cfg.Driver == "pppd" && runtime.GOOS == "windows" {
-		return nil, fmt.Errorf("pppd driver is not supported in Windows")
+	// set default driver
+	if cfg.Driver == "" {
+		cfg.Driver = "wireguard"
 	}
 
-	if !util.StrSliceContains(supportedDrivers, cfg.Driver) {
-		return nil, fmt.Errorf("%q driver is unsupported, supported drivers are: %q", cfg.Driver, supportedDrivers)
+	if err = cfg.Validate(); err != nil {
+		return nil, err
 	}
 
 	if cfg.ListenDNS == nil {
@@ -125,7 +240,5 @@ func ReadConfig(debug bool) (*Config, error) {
 	cfg.Uid = uid
 	cfg.Gid = gid
 
-	cfg.Debug = debug
-
 	return cfg, nil
 }
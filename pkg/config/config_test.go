@@ -0,0 +1,156 @@
+package config
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestMergeProfile(t *testing.T) {
+	raw := []byte(`
+driver: pppd
+dtls: true
+routes:
+- 1.2.3.4
+profiles:
+  lab:
+    server: lab.example
+    driver: wireguard
+    routes:
+    - 10.0.0.0/8
+`)
+
+	values, err := mergeProfile(raw, "lab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := yaml.Marshal(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{}
+	if err = yaml.Unmarshal(v, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server != "lab.example" || cfg.Driver != "wireguard" || !cfg.DTLS {
+		t.Errorf("unexpected merged config: %+v", cfg)
+	}
+	if v := cfg.Routes.GetNetworks(); len(v) != 1 || v[0].String() != "10.0.0.0/8" {
+		t.Errorf("unexpected merged routes: %s", v)
+	}
+
+	if _, err = mergeProfile(raw, "prod"); err == nil {
+		t.Errorf("unknown profile must return an error")
+	}
+}
+
+func TestMergeOverrides(t *testing.T) {
+	t.Setenv("GOF5_DTLS", "true")
+	t.Setenv("GOF5_ROUTES", "10.0.0.0/8, 192.168.0.0/16, fd00::/8, Git.corp.example.")
+	t.Setenv("GOF5_EXCLUDE_ROUTES", "10.1.0.0/16, ci.corp.example")
+	t.Setenv("GOF5_DRIVER", "pppd")
+	t.Setenv("GOF5_ROUTE_MARK", "0x100")
+	t.Setenv("GOF5_ROUTES_MODE", "append")
+
+	values := map[string]interface{}{
+		"dtls":   false,
+		"driver": "wireguard",
+		"ipv6":   true,
+	}
+	flags := map[string]string{
+		"driver": "wireguard",
+		"ipv6":   "false",
+	}
+	if err := mergeOverrides(values, flags); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := yaml.Marshal(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{}
+	if err = yaml.Unmarshal(v, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.DTLS || cfg.IPv6 || cfg.Driver != "wireguard" || cfg.RouteMark != 0x100 || cfg.RoutesMode != "append" {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+	if v := cfg.Routes.GetNetworks(); len(v) != 2 {
+		t.Errorf("unexpected routes: %s", v)
+	}
+	if v := cfg.Routes6.GetNetworks(); len(v) != 1 || v[0].String() != "fd00::/8" {
+		t.Errorf("unexpected IPv6 routes: %s", v)
+	}
+	if v := cfg.RouteHosts; len(v) != 1 || v[0] != "git.corp.example" {
+		t.Errorf("unexpected route hostnames: %s", v)
+	}
+	if v := cfg.ExcludeRoutes.GetNetworks(); len(v) != 1 || len(cfg.ExcludeRouteHosts) != 1 {
+		t.Errorf("unexpected excluded routes: %s %s", v, cfg.ExcludeRouteHosts)
+	}
+
+	t.Setenv("GOF5_IPV6", "maybe")
+	if err = mergeOverrides(values, nil); err == nil {
+		t.Errorf("invalid boolean must return an error")
+	}
+	t.Setenv("GOF5_IPV6", "false")
+
+	// hex values are accepted only for the marks, leading zeros are not octal
+	t.Setenv("GOF5_TUN_QUEUES", "010")
+	if err = mergeOverrides(values, nil); err != nil || values["tunQueues"] != 10 {
+		t.Errorf("unexpected tunQueues value: %v: %v", values["tunQueues"], err)
+	}
+	t.Setenv("GOF5_TUN_QUEUES", "0x2")
+	if err = mergeOverrides(values, nil); err == nil {
+		t.Errorf("hex tunQueues value must return an error")
+	}
+	t.Setenv("GOF5_TUN_QUEUES", "1")
+
+	// the marks are decimal or 0x prefixed hex, octal and binary prefixes
+	// are not accepted
+	for s, expected := range map[string]interface{}{
+		"256":   256,
+		"0x100": 256,
+		"010":   10,
+		"0b1":   nil,
+		"0o10":  nil,
+		"0x":    nil,
+	} {
+		t.Setenv("GOF5_ROUTE_MARK", s)
+		delete(values, "routeMark")
+		err = mergeOverrides(values, nil)
+		if expected == nil {
+			if err == nil {
+				t.Errorf("%q routeMark value must return an error", s)
+			}
+			continue
+		}
+		if err != nil || values["routeMark"] != expected {
+			t.Errorf("unexpected %q routeMark value: %v: %v", s, values["routeMark"], err)
+		}
+	}
+}
+
+func TestCheckKeys(t *testing.T) {
+	raw := []byte(`
+driver: pppd
+dtsl: true
+profiles:
+  work:
+    server: vpn.example.com
+    rotues:
+    - 10.0.0.0/8
+`)
+	err := checkKeys(raw)
+	if err == nil {
+		t.Fatal("unknown keys must return an error")
+	}
+	expected := "line 3: unknown dtsl key\nline 7: unknown rotues key"
+	if err.Error() != expected {
+		t.Errorf("unexpected error:\n%s\nexpected:\n%s", err, expected)
+	}
+
+	if err = checkKeys([]byte("driver: pppd\ndriver: wireguard\n")); err == nil {
+		t.Errorf("duplicate keys must return an error")
+	}
+}
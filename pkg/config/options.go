@@ -0,0 +1,186 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const envPrefix = "GOF5_"
+
+type kind int
+
+const (
+	stringKind kind = iota
+	boolKind
+	intKind
+	listKind
+	// decimal or 0x prefixed hex integer, e.g. a mark
+	hexKind
+)
+
+// Option describes a setting, which can be defined in the config file, in the
+// GOF5_* environment variable or as a CLI flag. Every layer overrides the
+// previous one: defaults < config file < environment < flags.
+type Option struct {
+	// config file key
+	Name string
+	// CLI flag name
+	Flag  string
+	Usage string
+	kind  kind
+}
+
+// Env returns the environment variable name
+func (o Option) Env() string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(o.Flag, "-", "_"))
+}
+
+// parse converts a flag or an environment variable string into a config value
+func (o Option) parse(s string) (interface{}, error) {
+	switch o.kind {
+	case boolKind:
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %q boolean value: %q", o.Flag, s)
+		}
+		return v, nil
+	case intKind, hexKind:
+		base := 10
+		if v, ok := strings.CutPrefix(s, "0x"); ok && o.kind == hexKind {
+			s, base = v, 16
+		}
+		v, err := strconv.ParseInt(s, base, 0)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %q integer value: %q", o.Flag, s)
+		}
+		return int(v), nil
+	case listKind:
+		// an empty string means an empty list
+		v := []string{}
+		for _, s := range strings.Split(s, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				v = append(v, s)
+			}
+		}
+		return v, nil
+	}
+	return s, nil
+}
+
+var Options = []Option{
+	// connection
+	{Name: "server", Flag: "server", Usage: "F5 server address"},
+	{Name: "username", Flag: "username", Usage: "VPN username"},
+	{Name: "password", Flag: "password", Usage: "VPN password"},
+	{Name: "sessionID", Flag: "session", Usage: "Reuse a session ID"},
+	{Name: "caCert", Flag: "ca-cert", Usage: "Path to a custom CA certificate"},
+	{Name: "cert", Flag: "cert", Usage: "Path to a user TLS certificate"},
+	{Name: "key", Flag: "key", Usage: "Path to a user TLS key"},
+	{Name: "closeSession", Flag: "close-session", Usage: "Close HTTPS VPN session on exit", kind: boolKind},
+	{Name: "debug", Flag: "debug", Usage: "Show debug logs", kind: boolKind},
+	{Name: "logFormat", Flag: "log-format", Usage: "Log format: text or json"},
+	{Name: "logLevel", Flag: "log-level", Usage: "Log levels, e.g. \"info,http=debug,ppp=warn\", subsystems: http, ppp, dns, route"},
+	{Name: "select", Flag: "select", Usage: "Select a server from available F5 servers", kind: boolKind},
+	{Name: "vpnProfile", Flag: "profile-name", Usage: "If multiple VPN profiles are found chose profile by name"},
+	{Name: "vpnProfileIndex", Flag: "profile-index", Usage: "If multiple VPN profiles are found chose profile n", kind: intKind},
+	{Name: "insecureTLS", Flag: "insecure-tls", Usage: "Skip TLS certificate check", kind: boolKind},
+	{Name: "renegotiation", Flag: "renegotiation", Usage: "TLS renegotiation support: RenegotiateNever, RenegotiateOnceAsClient or RenegotiateFreelyAsClient"},
+	{Name: "encryptCookies", Flag: "encrypt-cookies", Usage: "Encrypt saved cookies with a key, stored in the OS keyring", kind: boolKind},
+	// tunnel
+	{Name: "driver", Flag: "driver", Usage: "Tunnel driver: wireguard or pppd"},
+	{Name: "dtls", Flag: "dtls", Usage: "Use DTLS tunnel, when supported by the server", kind: boolKind},
+	{Name: "ipv6", Flag: "ipv6", Usage: "Enable IPv6", kind: boolKind},
+	{Name: "pppdArgs", Flag: "pppd-args", Usage: "Comma separated list of extra pppd arguments", kind: listKind},
+	{Name: "reconnect", Flag: "reconnect", Usage: "Reconnect, when the tunnel goes down", kind: boolKind},
+	{Name: "killSwitch", Flag: "kill-switch", Usage: "Drop all traffic outside of the VPN tunnel (Linux only)", kind: boolKind},
+	{Name: "killSwitchAllowLAN", Flag: "kill-switch-allow-lan", Usage: "Allow LAN traffic, when the kill switch is enabled", kind: boolKind},
+	{Name: "tunQueues", Flag: "tun-queues", Usage: "Number of TUN device queues, read concurrently (Linux only)", kind: intKind},
+	{Name: "tunOffload", Flag: "tun-offload", Usage: "Enable TUN device TCP segmentation offload, GRO is not implemented (Linux only)", kind: boolKind},
+	{Name: "netns", Flag: "netns", Usage: "Move the tunnel into the named network namespace, created when missing (Linux only)"},
+	{Name: "mtu", Flag: "mtu", Usage: "TUN MTU, the MTU negotiated with F5 is used by default", kind: intKind},
+	{Name: "bufferSize", Flag: "buffer-size", Usage: "TUN read buffer size, must fit the MTU", kind: intKind},
+	// routes and DNS
+	{Name: "routes", Flag: "routes", Usage: "Comma separated list of subnets and hostnames to be routed via VPN", kind: listKind},
+	{Name: "routesMode", Flag: "routes-mode", Usage: "How the custom routes are merged with the F5 routes: replace, append or subtract"},
+	{Name: "excludeRoutes", Flag: "exclude-routes", Usage: "Comma separated list of subnets and hostnames to be excluded from the VPN routes", kind: listKind},
+	{Name: "routeTable", Flag: "route-table", Usage: "Install routes into the dedicated routing table with a policy rule instead of the main table (Linux only)", kind: intKind},
+	{Name: "routeRule", Flag: "route-rule", Usage: "Traffic routed via the VPN table: destination, source or fwmark"},
+	{Name: "routeMark", Flag: "route-mark", Usage: "Traffic mark, which is routed via the VPN table in the fwmark mode", kind: hexKind},
+	{Name: "routeExcludeMark", Flag: "route-exclude-mark", Usage: "F5 server connection mark, which bypasses the VPN table", kind: hexKind},
+	{Name: "routeConflict", Flag: "route-conflict", Usage: "VPN routes and local networks conflict policy: warn, prefer-vpn, prefer-local or fail"},
+	{Name: "routeMetric", Flag: "route-metric", Usage: "VPN routes metric (Linux and Windows)", kind: intKind},
+	{Name: "dns", Flag: "dns", Usage: "Comma separated list of DNS zones to be resolved by VPN DNS servers", kind: listKind},
+	{Name: "listenDNS", Flag: "listen-dns", Usage: "DNS proxy listen address"},
+	{Name: "overrideDNS", Flag: "override-dns", Usage: "Comma separated list of DNS servers to override VPN DNS servers", kind: listKind},
+	{Name: "overrideDNSSuffix", Flag: "override-dns-suffix", Usage: "Comma separated list of DNS search suffixes to override VPN DNS suffixes", kind: listKind},
+	{Name: "disableDNS", Flag: "disable-dns", Usage: "Don't alter system DNS settings", kind: boolKind},
+	{Name: "rewriteResolv", Flag: "rewrite-resolv", Usage: "Rewrite /etc/resolv.conf instead of renaming", kind: boolKind},
+	{Name: "dnsLeakProtection", Flag: "dns-leak-protection", Usage: "Block DNS queries outside of the VPN (Linux only)", kind: boolKind},
+	// monitoring
+	{Name: "metricsListen", Flag: "metrics-listen", Usage: "Prometheus metrics listen address, e.g. 127.0.0.1:9305"},
+	{Name: "pcap", Flag: "pcap", Usage: "Write tunnel IP packets into a pcapng (or pcap with the .pcap extension) file"},
+	{Name: "pcapPPP", Flag: "pcap-ppp", Usage: "Additionally write raw F5 PPP frames into the pcapng file", kind: boolKind},
+	// hooks
+	{Name: "onConnect", Flag: "on-connect", Usage: "Script to execute, when the tunnel is established"},
+	{Name: "onDisconnect", Flag: "on-disconnect", Usage: "Script to execute, when the tunnel goes down"},
+	{Name: "onReconnect", Flag: "on-reconnect", Usage: "Script to execute instead of on-connect, when the tunnel is reestablished"},
+	{Name: "script", Flag: "script", Usage: "vpnc-script compatible script, which configures routes and DNS instead of gof5"},
+}
+
+// flagValue stores explicitly set flag values, so unset flags don't override
+// the config file and environment variables
+type flagValue struct {
+	option Option
+	values map[string]string
+}
+
+func (f *flagValue) String() string {
+	if f.values == nil {
+		return ""
+	}
+	return f.values[f.option.Name]
+}
+
+func (f *flagValue) Set(s string) error {
+	if _, err := f.option.parse(s); err != nil {
+		return err
+	}
+	f.values[f.option.Name] = s
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool {
+	return f.option.kind == boolKind
+}
+
+// RegisterFlags defines CLI flags for every option, explicitly set flag values
+// are saved into the values map
+func RegisterFlags(fs *flag.FlagSet, values map[string]string) {
+	for _, o := range Options {
+		fs.Var(&flagValue{option: o, values: values}, o.Flag, fmt.Sprintf("%s (env %s)", o.Usage, o.Env()))
+	}
+}
+
+// Lookup returns the CLI flag or the environment variable value of an option,
+// it is used before the config file is read
+func Lookup(name string, flags map[string]string) string {
+	if v, ok := flags[name]; ok {
+		return v
+	}
+	if o, ok := findOption(name); ok {
+		return os.Getenv(o.Env())
+	}
+	return ""
+}
+
+func findOption(name string) (Option, bool) {
+	for _, o := range Options {
+		if o.Name == name {
+			return o, true
+		}
+	}
+	return Option{}, false
+}
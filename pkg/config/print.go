@@ -0,0 +1,110 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"gopkg.in/yaml.v2"
+)
+
+const redacted = "<redacted>"
+
+// MarshalYAML returns the effective config in the Options order with
+// redacted secrets
+func (r Config) MarshalYAML() (interface{}, error) {
+	type tmp Config
+	raw, err := yaml.Marshal(tmp(r))
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]interface{}
+	if err = yaml.Unmarshal(raw, &values); err != nil {
+		return nil, err
+	}
+
+	if r.ListenDNS != nil {
+		values["listenDNS"] = r.ListenDNS.String()
+	}
+	if r.Routes != nil {
+		routes := []string{}
+		for _, v := range Networks(r.Routes, r.Routes6) {
+			routes = append(routes, v.String())
+		}
+		values["routes"] = append(routes, r.RouteHosts...)
+	}
+	if r.ExcludeRoutes != nil {
+		routes := []string{}
+		for _, v := range Networks(r.ExcludeRoutes, r.ExcludeRoutes6) {
+			routes = append(routes, v.String())
+		}
+		values["excludeRoutes"] = append(routes, r.ExcludeRouteHosts...)
+	}
+	if r.OverrideDNS != nil {
+		dns := make([]string, len(r.OverrideDNS))
+		for i, v := range r.OverrideDNS {
+			dns[i] = v.String()
+		}
+		values["overrideDNS"] = dns
+	}
+	if r.Password != "" {
+		values["password"] = redacted
+	}
+	if r.SessionID != "" {
+		values["sessionID"] = redacted
+	}
+
+	var v yaml.MapSlice
+	for _, o := range Options {
+		if value, ok := values[o.Name]; ok {
+			v = append(v, yaml.MapItem{Key: o.Name, Value: value})
+		}
+	}
+	return v, nil
+}
+
+// readConfigFile returns the config file contents or nil, when the default
+// config file doesn't exist
+func readConfigFile(path string) ([]byte, error) {
+	configPath, _, _, err := detectConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	path, explicit, err := configFile(configPath, path)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && !explicit {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cannot read config file: %s", err)
+	}
+	return raw, nil
+}
+
+// Print writes the config file contents or the effective config, i.e. the
+// config file merged with the profile, environment variables and CLI flags
+func Print(w io.Writer, path, profile string, flags map[string]string, effective bool) error {
+	if !effective {
+		raw, err := readConfigFile(path)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(raw)
+		return err
+	}
+
+	cfg, err := ReadConfig(path, profile, flags)
+	if err != nil {
+		return err
+	}
+	raw, err := yaml.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("cannot marshal config: %v", err)
+	}
+	_, err = w.Write(raw)
+	return err
+}
@@ -4,9 +4,10 @@ import (
 	"encoding/base64"
 	"encoding/xml"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"net/url"
+	"regexp"
 	"strings"
 
 	"github.com/kayrus/gof5/pkg/util"
@@ -15,13 +16,42 @@ import (
 )
 
 type Config struct {
-	Debug             bool           `yaml:"-"`
+	Debug bool `yaml:"debug"`
+	// text or json
+	LogFormat string `yaml:"logFormat"`
+	// default and per subsystem log levels, e.g. "info,http=debug"
+	LogLevel string `yaml:"logLevel"`
+	// selected connection profile name
+	Profile string `yaml:"-"`
+	// connection options, usually defined per profile
+	Server          string `yaml:"server"`
+	Username        string `yaml:"username"`
+	Password        string `yaml:"password"`
+	SessionID       string `yaml:"sessionID"`
+	Select          bool   `yaml:"select"`
+	VPNProfile      string `yaml:"vpnProfile"`
+	VPNProfileIndex int    `yaml:"vpnProfileIndex"`
+	CACert          string `yaml:"caCert"`
+	Cert            string `yaml:"cert"`
+	Key             string `yaml:"key"`
+	CloseSession    bool   `yaml:"closeSession"`
+	// tunnel options
 	Driver            string         `yaml:"driver"`
 	ListenDNS         net.IP         `yaml:"-"`
 	DNS               []string       `yaml:"dns"`
 	OverrideDNS       []net.IP       `yaml:"-"`
 	OverrideDNSSuffix []string       `yaml:"overrideDNSSuffix"`
 	Routes            *netaddr.IPSet `yaml:"-"`
+	Routes6           *netaddr.IPSet `yaml:"-"`
+	// hostnames, which resolved addresses are routed via VPN
+	RouteHosts []string `yaml:"-"`
+	// how the custom routes are merged with the F5 routes: replace, append or
+	// subtract
+	RoutesMode string `yaml:"routesMode"`
+	// subnets and hostnames, excluded from the custom or F5 routes
+	ExcludeRoutes     *netaddr.IPSet `yaml:"-"`
+	ExcludeRoutes6    *netaddr.IPSet `yaml:"-"`
+	ExcludeRouteHosts []string       `yaml:"-"`
 	PPPdArgs          []string       `yaml:"pppdArgs"`
 	InsecureTLS       bool           `yaml:"insecureTLS"`
 	DTLS              bool           `yaml:"dtls"`
@@ -31,6 +61,51 @@ type Config struct {
 	// rewrite /etc/resolv.conf instead of renaming
 	// required in ChromeOS, where /etc/resolv.conf cannot be renamed
 	RewriteResolv bool `yaml:"rewriteResolv"`
+	// block DNS queries, which are not sent to VPN DNS servers (Linux only)
+	DNSLeakProtection bool `yaml:"dnsLeakProtection"`
+	// drop all traffic outside of the VPN tunnel once connected (Linux only)
+	KillSwitch bool `yaml:"killSwitch"`
+	// allow LAN traffic, when the kill switch is enabled
+	KillSwitchAllowLAN bool `yaml:"killSwitchAllowLAN"`
+	// reconnect, when the tunnel goes down
+	Reconnect bool `yaml:"reconnect"`
+	// number of TUN device queues (Linux only)
+	TunQueues int `yaml:"tunQueues"`
+	// TUN device TCP segmentation offload, GRO is not implemented (Linux only)
+	TunOffload bool `yaml:"tunOffload"`
+	// install routes into the dedicated routing table (Linux only)
+	RouteTable int `yaml:"routeTable"`
+	// policy rule mode: destination, source or fwmark
+	RouteRule string `yaml:"routeRule"`
+	// traffic mark, which is routed via the VPN table in the fwmark mode
+	RouteMark int `yaml:"routeMark"`
+	// F5 server connection mark, its traffic bypasses the VPN table
+	RouteExcludeMark int `yaml:"routeExcludeMark"`
+	// VPN routes and local networks conflict policy: warn, prefer-vpn,
+	// prefer-local or fail
+	RouteConflict string `yaml:"routeConflict"`
+	// VPN routes metric (Linux and Windows)
+	RouteMetric int `yaml:"routeMetric"`
+	// run the tunnel inside the named network namespace (Linux only)
+	Netns string `yaml:"netns"`
+	// TUN MTU, the MTU negotiated with F5 is used, when zero
+	MTU int `yaml:"mtu"`
+	// TUN read buffer size, 1500 by default
+	BufferSize int `yaml:"bufferSize"`
+	// encrypt saved cookies with a key, stored in the OS keyring
+	EncryptCookies bool `yaml:"encryptCookies"`
+	// Prometheus metrics listen address, disabled when empty
+	MetricsListen string `yaml:"metricsListen"`
+	// tunnel packets capture file, pcapng or pcap
+	Pcap string `yaml:"pcap"`
+	// additionally capture raw F5 PPP frames
+	PcapPPP bool `yaml:"pcapPPP"`
+	// scripts, executed with vpnc-script environment variables
+	OnConnect    string `yaml:"onConnect"`
+	OnDisconnect string `yaml:"onDisconnect"`
+	OnReconnect  string `yaml:"onReconnect"`
+	// vpnc-script, which configures routes and DNS instead of gof5
+	Script string `yaml:"script"`
 	// tls regeneration, tls.RenegotiateNever by default
 	Renegotiation string `yaml:"renegotiation"`
 	// list of detected local DNS servers
@@ -49,10 +124,11 @@ func (r *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	type tmp Config
 	var s struct {
 		tmp
-		ListenDNS   *string  `yaml:"listenDNS"`
-		Routes      []string `yaml:"routes"`
-		PPPdArgs    []string `yaml:"pppdArgs"`
-		OverrideDNS []string `yaml:"overrideDNS"`
+		ListenDNS     *string  `yaml:"listenDNS"`
+		Routes        []string `yaml:"routes"`
+		ExcludeRoutes []string `yaml:"excludeRoutes"`
+		PPPdArgs      []string `yaml:"pppdArgs"`
+		OverrideDNS   []string `yaml:"overrideDNS"`
 	}
 
 	if err := unmarshal(&s.tmp); err != nil {
@@ -67,19 +143,35 @@ func (r *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 
 	if s.ListenDNS != nil {
 		r.ListenDNS = net.ParseIP(*s.ListenDNS)
+		if r.ListenDNS == nil {
+			return fmt.Errorf("failed to parse %q listenDNS IP address", *s.ListenDNS)
+		}
 	}
 
-	r.Routes = new(netaddr.IPSet)
+	// routes are nil, when not set, i.e. the routes pushed from F5 are used
 	if s.Routes != nil {
 		// handle the case, when routes is an empty list
-		parsedCIDRs, err := parseCIDRs(s.Routes, net.IPv4len)
+		var err error
+		r.Routes, r.Routes6, r.RouteHosts, err = parseRoutes(s.Routes)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(s.ExcludeRoutes) > 0 {
+		var err error
+		r.ExcludeRoutes, r.ExcludeRoutes6, r.ExcludeRouteHosts, err = parseRoutes(s.ExcludeRoutes)
 		if err != nil {
 			return err
 		}
-		r.Routes = subnetsToIPSet(parsedCIDRs)
 	}
 
 	if len(s.OverrideDNS) > 0 {
+		for _, v := range s.OverrideDNS {
+			if net.ParseIP(v).To4() == nil {
+				return fmt.Errorf("failed to parse %q overrideDNS IPv4 address", v)
+			}
+		}
 		r.OverrideDNS = processIPs(strings.Join(s.OverrideDNS, " "), net.IPv4len)
 	}
 
@@ -227,8 +319,10 @@ func (o *Object) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	o.ExcludeSubnets = processCIDRs(s.ExcludeSubnets, net.IPv4len)
 	o.ExcludeSubnets6 = processCIDRs(s.ExcludeSubnets6, net.IPv6len)
 
-	// TODO: support IPv6 routes
 	o.Routes = inverseCIDRs4(o.ExcludeSubnets)
+	if o.IPv6 {
+		o.Routes6 = inverseCIDRs6(o.ExcludeSubnets6)
+	}
 
 	o.HDLCFraming, err = strToBool(s.HDLCFraming)
 	if err != nil {
@@ -287,6 +381,45 @@ func processIPs(ips string, length int) []net.IP {
 	return nil
 }
 
+// parseRoutes returns the IPv4 and IPv6 routes and the hostnames
+func parseRoutes(v []string) (*netaddr.IPSet, *netaddr.IPSet, []string, error) {
+	var cidrs4, cidrs6 []string
+	cidrs, hosts := splitHostnames(v)
+	for _, v := range cidrs {
+		if strings.Contains(v, ":") {
+			cidrs6 = append(cidrs6, v)
+		} else {
+			cidrs4 = append(cidrs4, v)
+		}
+	}
+
+	parsed4, err := parseCIDRs(cidrs4, net.IPv4len)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	parsed6, err := parseCIDRs(cidrs6, net.IPv6len)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return subnetsToIPSet(parsed4), subnetsToIPSet(parsed6), hosts, nil
+}
+
+var hostnameRe = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?\.)*[a-zA-Z]([a-zA-Z0-9-]*[a-zA-Z0-9])?\.?$`)
+
+// splitHostnames separates the hostnames from the IP addresses and CIDRs
+func splitHostnames(v []string) ([]string, []string) {
+	var cidrs, hosts []string
+	for _, s := range v {
+		if net.ParseIP(s) == nil && hostnameRe.MatchString(s) {
+			hosts = append(hosts, strings.TrimSuffix(strings.ToLower(s), "."))
+			continue
+		}
+		cidrs = append(cidrs, s)
+	}
+	return cidrs, hosts
+}
+
 func parseCIDRs(cidrs []string, length int) ([]*net.IPNet, error) {
 	t := make([]*net.IPNet, len(cidrs))
 	for i, v := range cidrs {
@@ -296,7 +429,7 @@ func parseCIDRs(cidrs []string, length int) ([]*net.IPNet, error) {
 		if ip := net.ParseIP(v); ip != nil {
 			cidr = &net.IPNet{
 				IP:   ip,
-				Mask: net.CIDRMask(32, 32),
+				Mask: net.CIDRMask(length*8, length*8),
 			}
 		} else {
 			// parse 1.2.3.4/12 format
@@ -329,10 +462,14 @@ func processCIDRs(cidrs string, length int) []*net.IPNet {
 				ip := net.ParseIP(v[0])
 				mask := net.ParseIP(v[1])
 				if ip == nil || mask == nil {
-					log.Printf("Cannot parse %q CIDR", v)
+					slog.Warn("Cannot parse CIDR", "cidr", v)
 					continue
 				}
 				if length == net.IPv4len {
+					if ip.To4() == nil || mask.To4() == nil {
+						slog.Warn("Cannot parse IPv4 CIDR", "cidr", v)
+						continue
+					}
 					t = append(t, &net.IPNet{
 						IP:   ip.To4(),
 						Mask: net.IPMask(mask.To4()),
@@ -345,13 +482,24 @@ func processCIDRs(cidrs string, length int) []*net.IPNet {
 				}
 				continue
 			}
-			log.Printf("Cannot parse %q CIDR", v)
+			slog.Warn("Cannot parse CIDR", "cidr", v)
 		}
 		return t
 	}
 	return nil
 }
 
+// Networks returns the networks of the sets, nil sets are skipped
+func Networks(sets ...*netaddr.IPSet) []*net.IPNet {
+	var res []*net.IPNet
+	for _, s := range sets {
+		if s != nil {
+			res = append(res, s.GetNetworks()...)
+		}
+	}
+	return res
+}
+
 func subnetsToIPSet(subnets []*net.IPNet) *netaddr.IPSet {
 	// initialize an empty IPSet
 	ipSet4 := &netaddr.IPSet{}
@@ -407,6 +555,44 @@ func inverseCIDRs4(exclude []*net.IPNet) *netaddr.IPSet {
 	return ipSet4
 }
 
+func inverseCIDRs6(exclude []*net.IPNet) *netaddr.IPSet {
+	// initialize an empty IPSet
+	ipSet6 := &netaddr.IPSet{}
+
+	all := &net.IPNet{
+		IP:   net.IPv6zero,
+		Mask: net.CIDRMask(0, 128),
+	}
+	ipSet6.InsertNet(all)
+
+	// remove reserved addresses (rfc4291), including the loopback and the
+	// IPv4 mapped addresses
+	reserved := &net.IPNet{
+		IP:   net.IPv6zero,
+		Mask: net.CIDRMask(8, 128),
+	}
+	ipSet6.RemoveNet(reserved)
+
+	unicast := &net.IPNet{
+		IP:   net.ParseIP("fe80::"),
+		Mask: net.CIDRMask(10, 128),
+	}
+	ipSet6.RemoveNet(unicast)
+
+	multicast := &net.IPNet{
+		IP:   net.ParseIP("ff00::"),
+		Mask: net.CIDRMask(8, 128),
+	}
+	ipSet6.RemoveNet(multicast)
+
+	for _, v := range exclude {
+		ipSet6.RemoveNet(v)
+	}
+
+	// get a routes list
+	return ipSet6
+}
+
 type AgentInfo struct {
 	XMLName              xml.Name `xml:"agent_info"`
 	Type                 string   `xml:"type"`
@@ -0,0 +1,255 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/kayrus/gof5/pkg/logging"
+	"github.com/kayrus/gof5/pkg/policy"
+	"github.com/kayrus/gof5/pkg/util"
+
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	supportedRenegotiation = []string{"", "RenegotiateNever", "RenegotiateOnceAsClient", "RenegotiateFreelyAsClient"}
+	supportedRouteConflict = []string{"", "warn", "prefer-vpn", "prefer-local", "fail"}
+	supportedRoutesMode    = []string{"", "replace", "append", "subtract"}
+	unknownKeyRe           = regexp.MustCompile(`field (\S+) not found in type .*$`)
+)
+
+const (
+	// IPv4 datagram size, every host must accept
+	minMTU = 576
+	// F5 frame size is a 16 bit field, which includes the PPP header
+	maxBufferSize = 0xffff - 4
+)
+
+// strictType builds a struct type from the Options list, which is used to
+// detect unknown keys in the config file and in profiles
+func strictType() reflect.Type {
+	fields := make([]reflect.StructField, len(Options))
+	for i, o := range Options {
+		fields[i] = reflect.StructField{
+			Name: fmt.Sprintf("Option%d", i),
+			Type: reflect.TypeOf((*interface{})(nil)).Elem(),
+			Tag:  reflect.StructTag(fmt.Sprintf("yaml:%q", o.Name)),
+		}
+	}
+	profile := reflect.StructOf(fields)
+
+	fields = append(fields, reflect.StructField{
+		Name: "Profiles",
+		Type: reflect.MapOf(reflect.TypeOf(""), reflect.PtrTo(profile)),
+		Tag:  `yaml:"profiles"`,
+	})
+	return reflect.StructOf(fields)
+}
+
+// checkKeys reports unknown and duplicate keys with their line numbers
+func checkKeys(raw []byte) error {
+	err := yaml.UnmarshalStrict(raw, reflect.New(strictType()).Interface())
+	if e, ok := err.(*yaml.TypeError); ok {
+		errs := make([]string, len(e.Errors))
+		for i, v := range e.Errors {
+			errs[i] = unknownKeyRe.ReplaceAllString(v, "unknown $1 key")
+		}
+		return fmt.Errorf("%s", strings.Join(errs, "\n"))
+	}
+	return err
+}
+
+// Validate performs the semantic config validation
+func (r *Config) Validate() error {
+	var errs []error
+
+	if r.Driver == "wireguard" {
+		if err := checkWinTunDriver(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if r.Driver == "pppd" && runtime.GOOS == "windows" {
+		errs = append(errs, fmt.Errorf("pppd driver is not supported in Windows"))
+	}
+
+	if r.DNSLeakProtection && runtime.GOOS != "linux" {
+		errs = append(errs, fmt.Errorf("DNS leak protection is supported only in Linux"))
+	}
+
+	if r.KillSwitch && runtime.GOOS != "linux" {
+		errs = append(errs, fmt.Errorf("kill switch is supported only in Linux"))
+	}
+
+	if r.MTU != 0 && (r.MTU < minMTU || r.MTU > maxBufferSize) {
+		errs = append(errs, fmt.Errorf("mtu must be between %d and %d", minMTU, maxBufferSize))
+	}
+
+	if r.BufferSize != 0 && (r.BufferSize < minMTU || r.BufferSize > maxBufferSize) {
+		errs = append(errs, fmt.Errorf("bufferSize must be between %d and %d", minMTU, maxBufferSize))
+	}
+
+	if r.TunQueues < 0 {
+		errs = append(errs, fmt.Errorf("tunQueues cannot be negative"))
+	}
+
+	if (r.TunQueues > 1 || r.TunOffload) && runtime.GOOS != "linux" {
+		errs = append(errs, fmt.Errorf("multi-queue TUN and offloads are supported only in Linux"))
+	}
+
+	if (r.TunQueues > 1 || r.TunOffload) && r.Driver == "pppd" {
+		errs = append(errs, fmt.Errorf("multi-queue TUN and offloads are not supported with the pppd driver"))
+	}
+
+	if r.RouteTable != 0 {
+		if runtime.GOOS != "linux" {
+			errs = append(errs, fmt.Errorf("policy routing is supported only in Linux"))
+		}
+		// unspec, default, main and local tables
+		if r.RouteTable < 0 || r.RouteTable >= 253 && r.RouteTable <= 255 {
+			errs = append(errs, fmt.Errorf("routeTable %d is reserved or invalid", r.RouteTable))
+		}
+		if r.Netns != "" || r.Script != "" {
+			errs = append(errs, fmt.Errorf("routeTable cannot be used with netns and script options"))
+		}
+		if r.RouteRule != "" && !util.StrSliceContains(policy.Modes, r.RouteRule) {
+			errs = append(errs, fmt.Errorf("unknown routeRule value: %q, supported values are: %q", r.RouteRule, policy.Modes))
+		}
+		if r.RouteRule == policy.Fwmark && r.RouteMark <= 0 {
+			errs = append(errs, fmt.Errorf("routeMark is required by the fwmark routeRule"))
+		}
+	} else if r.RouteRule != "" || r.RouteMark != 0 || r.RouteExcludeMark != 0 {
+		errs = append(errs, fmt.Errorf("routeRule, routeMark and routeExcludeMark require routeTable"))
+	}
+
+	if r.RouteMark < 0 || r.RouteExcludeMark < 0 {
+		errs = append(errs, fmt.Errorf("routeMark and routeExcludeMark cannot be negative"))
+	} else if r.RouteMark != 0 && r.RouteMark == r.RouteExcludeMark {
+		errs = append(errs, fmt.Errorf("routeMark and routeExcludeMark must differ"))
+	}
+
+	if !util.StrSliceContains(supportedRoutesMode, r.RoutesMode) {
+		errs = append(errs, fmt.Errorf("unknown routesMode value: %q, supported values are: %q", r.RoutesMode, supportedRoutesMode[1:]))
+	}
+
+	if !r.IPv6 && len(Networks(r.Routes6, r.ExcludeRoutes6)) > 0 {
+		errs = append(errs, fmt.Errorf("IPv6 routes require the ipv6 option"))
+	}
+
+	if !util.StrSliceContains(supportedRouteConflict, r.RouteConflict) {
+		errs = append(errs, fmt.Errorf("unknown routeConflict value: %q, supported values are: %q", r.RouteConflict, supportedRouteConflict[1:]))
+	}
+
+	if r.RouteMetric < 0 {
+		errs = append(errs, fmt.Errorf("routeMetric cannot be negative"))
+	}
+
+	if r.RouteMetric > 0 && runtime.GOOS != "linux" && runtime.GOOS != "windows" {
+		errs = append(errs, fmt.Errorf("routeMetric is supported only in Linux and Windows"))
+	}
+
+	if r.Netns != "" {
+		if runtime.GOOS != "linux" {
+			errs = append(errs, fmt.Errorf("network namespaces are supported only in Linux"))
+		}
+		if r.Driver == "pppd" {
+			errs = append(errs, fmt.Errorf("network namespace is not supported with the pppd driver"))
+		}
+		// hostnames are resolved in the host network namespace
+		if len(r.RouteHosts) > 0 || len(r.ExcludeRouteHosts) > 0 {
+			errs = append(errs, fmt.Errorf("network namespace cannot be used with hostnames in routes and excludeRoutes"))
+		}
+		if strings.Contains(r.Netns, "/") || r.Netns == "." || r.Netns == ".." {
+			errs = append(errs, fmt.Errorf("invalid %q network namespace name", r.Netns))
+		}
+		// these options configure the host
+		if len(r.DNS) > 0 || r.KillSwitch || r.DNSLeakProtection || r.Script != "" {
+			errs = append(errs, fmt.Errorf("network namespace cannot be used with dns, killSwitch, dnsLeakProtection and script options"))
+		}
+	}
+
+	if !util.StrSliceContains(supportedDrivers, r.Driver) {
+		errs = append(errs, fmt.Errorf("%q driver is unsupported, supported drivers are: %q", r.Driver, supportedDrivers))
+	}
+
+	if !util.StrSliceContains(supportedRenegotiation, r.Renegotiation) {
+		errs = append(errs, fmt.Errorf("unknown renegotiation value: %q, supported values are: %q", r.Renegotiation, supportedRenegotiation[1:]))
+	}
+
+	if r.VPNProfileIndex < 0 {
+		errs = append(errs, fmt.Errorf("profile-index cannot be negative"))
+	}
+
+	if err := logging.CheckFormat(r.LogFormat); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := logging.ParseLevels(r.LogLevel, r.Debug); err != nil {
+		errs = append(errs, err)
+	}
+
+	if r.MetricsListen != "" {
+		if _, _, err := net.SplitHostPort(r.MetricsListen); err != nil {
+			errs = append(errs, fmt.Errorf("invalid metricsListen address: %v", err))
+		}
+	}
+
+	if r.Pcap != "" && r.Driver == "pppd" {
+		errs = append(errs, fmt.Errorf("packet capture is not supported with the pppd driver"))
+	}
+
+	if r.PcapPPP && (r.Pcap == "" || strings.EqualFold(filepath.Ext(r.Pcap), ".pcap")) {
+		errs = append(errs, fmt.Errorf("pcapPPP requires a pcapng file"))
+	}
+
+	if r.Cert != "" && r.Key == "" || r.Cert == "" && r.Key != "" {
+		errs = append(errs, fmt.Errorf("both TLS certificate and key must be set"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Check validates the global config and every profile, it returns the list
+// of checked profiles
+func Check(path string, flags map[string]string) ([]string, error) {
+	if _, err := ReadConfig(path, "", flags); err != nil {
+		return nil, err
+	}
+
+	raw, err := readConfigFile(path)
+	if err != nil || raw == nil {
+		return nil, err
+	}
+
+	profiles, err := profileNames(raw)
+	if err != nil {
+		return nil, err
+	}
+	for _, profile := range profiles {
+		if _, err := ReadConfig(path, profile, flags); err != nil {
+			return nil, fmt.Errorf("%q profile: %v", profile, err)
+		}
+	}
+
+	return profiles, nil
+}
+
+func profileNames(raw []byte) ([]string, error) {
+	var v struct {
+		Profiles yaml.MapSlice `yaml:"profiles"`
+	}
+	if err := yaml.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+	names := make([]string, len(v.Profiles))
+	for i, p := range v.Profiles {
+		names[i] = fmt.Sprintf("%v", p.Key)
+	}
+	return names, nil
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func ipNetsToStrings(nets []*net.IPNet) []string {
+	var t []string
+	for _, v := range nets {
+		t = append(t, v.String())
+	}
+	return t
+}
+
+// objectJSON renders the decoded connection parameters in a human readable form
+func objectJSON(o Object) interface{} {
+	var routes, routes6 []string
+	if o.Routes != nil {
+		routes = ipNetsToStrings(o.Routes.GetNetworks())
+	}
+	if o.Routes6 != nil {
+		routes6 = ipNetsToStrings(o.Routes6.GetNetworks())
+	}
+	return struct {
+		Object
+		HDLCFraming     Bool
+		ExcludeSubnets  []string
+		ExcludeSubnets6 []string
+		Routes          []string
+		Routes6         []string
+	}{
+		Object:          o,
+		HDLCFraming:     o.HDLCFraming,
+		ExcludeSubnets:  ipNetsToStrings(o.ExcludeSubnets),
+		ExcludeSubnets6: ipNetsToStrings(o.ExcludeSubnets6),
+		Routes:          routes,
+		Routes6:         routes6,
+	}
+}
+
+func checkGolden(t *testing.T, name string, v interface{}) {
+	t.Helper()
+	got, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, '\n')
+
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, expected) {
+		t.Errorf("%s mismatch:\n%s\nexpected:\n%s", path, got, expected)
+	}
+}
+
+func readTestdata(t testing.TB, name string) []byte {
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestFavoriteGolden(t *testing.T) {
+	var v Favorite
+	if err := xml.Unmarshal(readTestdata(t, "connect.xml"), &v); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "connect", objectJSON(v.Object))
+}
+
+func TestFavoriteIPv6Golden(t *testing.T) {
+	var v Favorite
+	if err := xml.Unmarshal(readTestdata(t, "connect6.xml"), &v); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "connect6", objectJSON(v.Object))
+}
+
+func TestProfilesGolden(t *testing.T) {
+	var v Profiles
+	if err := xml.Unmarshal(readTestdata(t, "profiles.xml"), &v); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "profiles", v)
+}
+
+func TestPreConfigProfileGolden(t *testing.T) {
+	var v PreConfigProfile
+	if err := xml.Unmarshal(readTestdata(t, "preconfig.xml"), &v); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "preconfig", v)
+}
+
+func FuzzFavorite(f *testing.F) {
+	f.Add(readTestdata(f, "connect.xml"))
+	f.Add(readTestdata(f, "connect6.xml"))
+	f.Add([]byte(`<favorite><object><ExcludeSubnets0>::1/ffff:: 1.2.3.4/::</ExcludeSubnets0><ExcludeSubnets6_0>1.2.3.4/255.0.0.0</ExcludeSubnets6_0></object></favorite>`))
+	f.Add([]byte(`<favorite><object><TrafficControl0>%3Cflow</TrafficControl0><DNS6_0>foo 1.2.3.4</DNS6_0></object></favorite>`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var v Favorite
+		if xml.Unmarshal(data, &v) == nil {
+			objectJSON(v.Object)
+		}
+	})
+}
+
+func FuzzProfiles(f *testing.F) {
+	f.Add(readTestdata(f, "profiles.xml"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var v Profiles
+		xml.Unmarshal(data, &v)
+	})
+}
+
+func FuzzPreConfigProfile(f *testing.F) {
+	f.Add(readTestdata(f, "preconfig.xml"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var v PreConfigProfile
+		xml.Unmarshal(data, &v)
+	})
+}
@@ -3,7 +3,7 @@ package cookie
 import (
 	"fmt"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
@@ -11,48 +11,142 @@ import (
 	"runtime"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/kayrus/gof5/pkg/config"
 
 	"gopkg.in/yaml.v2"
 )
 
-const cookiesName = "cookies.yaml"
+const (
+	cookiesName          = "cookies.yaml"
+	encryptedCookiesName = "cookies.enc"
+)
+
+type storedCookie struct {
+	Name     string     `yaml:"name"`
+	Value    string     `yaml:"value"`
+	Path     string     `yaml:"path,omitempty"`
+	Domain   string     `yaml:"domain,omitempty"`
+	Expires  *time.Time `yaml:"expires,omitempty"`
+	Secure   bool       `yaml:"secure,omitempty"`
+	HttpOnly bool       `yaml:"httpOnly,omitempty"`
+}
 
-func parseCookies(configPath string) map[string][]string {
-	cookies := make(map[string][]string)
+func readCookiesFile(cfg *config.Config) ([]byte, error) {
+	if !cfg.EncryptCookies {
+		return ioutil.ReadFile(filepath.Join(cfg.Path, cookiesName))
+	}
+
+	v, err := ioutil.ReadFile(filepath.Join(cfg.Path, encryptedCookiesName))
+	if err != nil {
+		return nil, err
+	}
 
-	cookiesPath := filepath.Join(configPath, cookiesName)
-	v, err := ioutil.ReadFile(cookiesPath)
+	key, err := getKey(cfg, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return decrypt(key, v)
+}
+
+func writeCookiesFile(cfg *config.Config, v []byte) error {
+	cookiesPath := filepath.Join(cfg.Path, cookiesName)
+
+	if cfg.EncryptCookies {
+		key, err := getKey(cfg, true)
+		if err != nil {
+			return err
+		}
+		v, err = encrypt(key, v)
+		if err != nil {
+			return err
+		}
+		// remove the plain text cookies
+		if err = os.Remove(cookiesPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		cookiesPath = filepath.Join(cfg.Path, encryptedCookiesName)
+	}
+
+	if err := ioutil.WriteFile(cookiesPath, v, 0600); err != nil {
+		return err
+	}
+
+	if runtime.GOOS != "windows" {
+		if err := os.Chown(cookiesPath, cfg.Uid, cfg.Gid); err != nil {
+			return fmt.Errorf("failed to set an owner for cookies file: %s", err)
+		}
+	}
+
+	return nil
+}
+
+func parseCookies(cfg *config.Config) map[string][]storedCookie {
+	cookies := make(map[string][]storedCookie)
+
+	v, err := readCookiesFile(cfg)
 	if err != nil {
 		// skip "no such file or directory" error on the first startup
 		if e, ok := err.(*os.PathError); !ok || e.Unwrap() != syscall.ENOENT {
-			log.Printf("Cannot read cookies file: %v", err)
+			slog.Warn("Cannot read cookies file", "err", err)
 		}
 		return cookies
 	}
 
-	if err = yaml.Unmarshal(v, &cookies); err != nil {
-		log.Printf("Cannot parse cookies: %v", err)
+	if err = yaml.Unmarshal(v, &cookies); err == nil {
+		return cookies
+	}
+
+	// fallback to the legacy "name=value" format
+	legacy := make(map[string][]string)
+	if err := yaml.Unmarshal(v, &legacy); err != nil {
+		slog.Warn("Cannot parse cookies", "err", err)
+		return cookies
+	}
+	for host, v := range legacy {
+		for _, c := range v {
+			if v := strings.SplitN(c, "=", 2); len(v) == 2 {
+				cookies[host] = append(cookies[host], storedCookie{
+					Name:  v[0],
+					Value: strings.Trim(v[1], `"`),
+				})
+			}
+		}
 	}
 
 	return cookies
 }
 
 func ReadCookies(c *http.Client, u *url.URL, cfg *config.Config, sessionID string) {
-	v := parseCookies(cfg.Path)
+	v := parseCookies(cfg)
 	if v, ok := v[u.Host]; ok {
+		now := time.Now()
 		var cookies []*http.Cookie
 		for _, c := range v {
-			if v := strings.Split(c, "="); len(v) == 2 {
-				cookies = append(cookies, &http.Cookie{Name: v[0], Value: v[1]})
+			if c.Expires != nil && c.Expires.Before(now) {
+				slog.Debug("Skipping expired cookie", "name", c.Name)
+				continue
+			}
+			cookie := &http.Cookie{
+				Name:     c.Name,
+				Value:    c.Value,
+				Path:     c.Path,
+				Domain:   c.Domain,
+				Secure:   c.Secure,
+				HttpOnly: c.HttpOnly,
 			}
+			if c.Expires != nil {
+				cookie.Expires = *c.Expires
+			}
+			cookies = append(cookies, cookie)
 		}
 		c.Jar.SetCookies(u, cookies)
 	}
 
 	if sessionID != "" {
-		log.Printf("Overriding session ID from a CLI argument")
+		slog.Info("Overriding session ID from a CLI argument")
 		// override session ID from CLI parameter
 		cookies := []*http.Cookie{
 			{Name: "MRHSession", Value: sessionID},
@@ -62,29 +156,42 @@ func ReadCookies(c *http.Client, u *url.URL, cfg *config.Config, sessionID strin
 }
 
 func SaveCookies(c *http.Client, u *url.URL, cfg *config.Config) error {
-	raw := parseCookies(cfg.Path)
+	raw := parseCookies(cfg)
+
+	var cookies []*http.Cookie
+	if jar, ok := c.Jar.(*Jar); ok {
+		cookies = jar.FullCookies(u)
+	} else {
+		cookies = c.Jar.Cookies(u)
+	}
+
 	// empty current cookies list
 	raw[u.Host] = nil
 	// write down new cookies
-	for _, c := range c.Jar.Cookies(u) {
-		raw[u.Host] = append(raw[u.Host], c.String())
+	for _, c := range cookies {
+		v := storedCookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Path:     c.Path,
+			Domain:   c.Domain,
+			Secure:   c.Secure,
+			HttpOnly: c.HttpOnly,
+		}
+		if !c.Expires.IsZero() {
+			expires := c.Expires
+			v.Expires = &expires
+		}
+		raw[u.Host] = append(raw[u.Host], v)
 	}
 
-	cookies, err := yaml.Marshal(&raw)
+	v, err := yaml.Marshal(&raw)
 	if err != nil {
 		return fmt.Errorf("cannot marshal cookies: %v", err)
 	}
 
-	cookiesPath := filepath.Join(cfg.Path, cookiesName)
-	if err = ioutil.WriteFile(cookiesPath, cookies, 0600); err != nil {
+	if err = writeCookiesFile(cfg, v); err != nil {
 		return fmt.Errorf("failed to save cookies: %s", err)
 	}
 
-	if runtime.GOOS != "windows" {
-		if err = os.Chown(cookiesPath, cfg.Uid, cfg.Gid); err != nil {
-			return fmt.Errorf("failed to set an owner for cookies file: %s", err)
-		}
-	}
-
 	return nil
 }
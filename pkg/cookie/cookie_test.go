@@ -0,0 +1,51 @@
+package cookie
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/kayrus/gof5/pkg/config"
+)
+
+func TestParseLegacyCookies(t *testing.T) {
+	cfg := &config.Config{Path: t.TempDir()}
+	raw := []byte("f5.com:\n- MRHSession=abc\n- F5_ST=1z1z1z=\n")
+	if err := ioutil.WriteFile(filepath.Join(cfg.Path, cookiesName), raw, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cookies := parseCookies(cfg)["f5.com"]
+	if len(cookies) != 2 {
+		t.Fatalf("expected 2 cookies, got %d", len(cookies))
+	}
+	if v := cookies[1].Value; v != "1z1z1z=" {
+		t.Errorf("cookie value containing '=' is broken: %q", v)
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, keySize)
+	plaintext := []byte("MRHSession=abc")
+
+	ciphertext, err := encrypt(key, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(ciphertext, plaintext) {
+		t.Errorf("ciphertext contains plain text")
+	}
+
+	v, err := decrypt(key, ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(v, plaintext) {
+		t.Errorf("decrypted %q doesn't correspond to %q", v, plaintext)
+	}
+
+	if _, err = decrypt(bytes.Repeat([]byte{2}, keySize), ciphertext); err == nil {
+		t.Errorf("decryption with a wrong key must fail")
+	}
+}
@@ -0,0 +1,86 @@
+package cookie
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+
+	"github.com/kayrus/gof5/pkg/config"
+)
+
+const (
+	// keyring item attributes
+	keyringService = "gof5"
+	keyringAccount = "cookies"
+	// AES-256
+	keySize = 32
+)
+
+// getKey returns the cookies encryption key from the OS keyring, the key is
+// generated and saved, when it doesn't exist and create is true
+func getKey(cfg *config.Config, create bool) ([]byte, error) {
+	v, err := readKey(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cookies encryption key: %v", err)
+	}
+	if v != "" {
+		key, err := base64.StdEncoding.DecodeString(v)
+		if err != nil || len(key) != keySize {
+			return nil, fmt.Errorf("invalid cookies encryption key in the keyring")
+		}
+		return key, nil
+	}
+
+	if !create {
+		return nil, fmt.Errorf("cookies encryption key was not found in the keyring")
+	}
+
+	key := make([]byte, keySize)
+	if _, err = io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("failed to generate cookies encryption key: %v", err)
+	}
+	if err = storeKey(cfg, base64.StdEncoding.EncodeToString(key)); err != nil {
+		return nil, fmt.Errorf("failed to save cookies encryption key: %v", err)
+	}
+
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encrypt returns the nonce followed by the AES-GCM ciphertext
+func encrypt(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func decrypt(key, ciphertext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, fmt.Errorf("encrypted cookies are too short")
+	}
+	v, err := gcm.Open(nil, ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt cookies: %v", err)
+	}
+	return v, nil
+}
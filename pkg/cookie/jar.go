@@ -0,0 +1,73 @@
+package cookie
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Jar is a cookie jar, which additionally keeps the cookie attributes, e.g.
+// Path, Domain, Expires and Secure. The standard cookiejar.Jar returns only
+// names and values, which are not enough to restore a session correctly.
+type Jar struct {
+	*cookiejar.Jar
+	sync.Mutex
+	// host -> cookie name -> cookie
+	cookies map[string]map[string]*http.Cookie
+}
+
+func NewJar() (*Jar, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Jar{
+		Jar:     jar,
+		cookies: make(map[string]map[string]*http.Cookie),
+	}, nil
+}
+
+// SetCookies implements the http.CookieJar interface
+func (j *Jar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.Jar.SetCookies(u, cookies)
+
+	j.Lock()
+	defer j.Unlock()
+
+	if j.cookies[u.Host] == nil {
+		j.cookies[u.Host] = make(map[string]*http.Cookie)
+	}
+
+	now := time.Now()
+	for _, c := range cookies {
+		if c.MaxAge < 0 || !c.Expires.IsZero() && c.Expires.Before(now) {
+			// the cookie is deleted by the server
+			delete(j.cookies[u.Host], c.Name)
+			continue
+		}
+		v := *c
+		if v.MaxAge > 0 {
+			v.Expires = now.Add(time.Duration(v.MaxAge) * time.Second)
+			v.MaxAge = 0
+		}
+		j.cookies[u.Host][c.Name] = &v
+	}
+}
+
+// FullCookies returns the cookies with their attributes for a given URL
+func (j *Jar) FullCookies(u *url.URL) []*http.Cookie {
+	j.Lock()
+	defer j.Unlock()
+
+	var cookies []*http.Cookie
+	for _, c := range j.Jar.Cookies(u) {
+		if v, ok := j.cookies[u.Host][c.Name]; ok {
+			cookies = append(cookies, v)
+			continue
+		}
+		cookies = append(cookies, c)
+	}
+	return cookies
+}
@@ -0,0 +1,44 @@
+//go:build darwin
+// +build darwin
+
+package cookie
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/kayrus/gof5/pkg/config"
+)
+
+// security runs the keychain CLI as a sudo user, because the login keychain
+// belongs to the user
+func security(cfg *config.Config, args ...string) *exec.Cmd {
+	cmd := exec.Command("security", args...)
+	if os.Geteuid() == 0 && cfg.Uid != 0 {
+		cmd.SysProcAttr = &syscall.SysProcAttr{
+			Credential: &syscall.Credential{
+				Uid: uint32(cfg.Uid),
+				Gid: uint32(cfg.Gid),
+			},
+		}
+	}
+	return cmd
+}
+
+func readKey(cfg *config.Config) (string, error) {
+	out, err := security(cfg, "find-generic-password", "-s", keyringService, "-a", keyringAccount, "-w").Output()
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			// the item doesn't exist
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func storeKey(cfg *config.Config, key string) error {
+	return security(cfg, "add-generic-password", "-U", "-s", keyringService, "-a", keyringAccount, "-w", key).Run()
+}
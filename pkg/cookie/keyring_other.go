@@ -0,0 +1,18 @@
+//go:build !linux && !freebsd && !darwin && !windows
+// +build !linux,!freebsd,!darwin,!windows
+
+package cookie
+
+import (
+	"fmt"
+
+	"github.com/kayrus/gof5/pkg/config"
+)
+
+func readKey(_ *config.Config) (string, error) {
+	return "", fmt.Errorf("OS keyring is not supported")
+}
+
+func storeKey(_ *config.Config, _ string) error {
+	return fmt.Errorf("OS keyring is not supported")
+}
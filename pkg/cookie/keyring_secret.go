@@ -0,0 +1,56 @@
+//go:build linux || freebsd
+// +build linux freebsd
+
+package cookie
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/kayrus/gof5/pkg/config"
+)
+
+// secretTool runs the libsecret CLI as a sudo user, because the keyring
+// belongs to the user's session
+func secretTool(cfg *config.Config, stdin io.Reader, args ...string) ([]byte, error) {
+	cmd := exec.Command("secret-tool", args...)
+	cmd.Stdin = stdin
+	if os.Geteuid() == 0 && cfg.Uid != 0 {
+		cmd.SysProcAttr = &syscall.SysProcAttr{
+			Credential: &syscall.Credential{
+				Uid: uint32(cfg.Uid),
+				Gid: uint32(cfg.Gid),
+			},
+		}
+		cmd.Env = append(os.Environ(), fmt.Sprintf("DBUS_SESSION_BUS_ADDRESS=unix:path=/run/user/%d/bus", cfg.Uid))
+	}
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil && stderr.Len() > 0 {
+		return nil, fmt.Errorf("%v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return out, err
+}
+
+func readKey(cfg *config.Config) (string, error) {
+	out, err := secretTool(cfg, nil, "lookup", "service", keyringService, "account", keyringAccount)
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			// the item doesn't exist
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func storeKey(cfg *config.Config, key string) error {
+	_, err := secretTool(cfg, strings.NewReader(key), "store", "--label=gof5 cookies encryption key", "service", keyringService, "account", keyringAccount)
+	return err
+}
@@ -0,0 +1,52 @@
+//go:build windows
+// +build windows
+
+package cookie
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"github.com/kayrus/gof5/pkg/config"
+
+	"golang.org/x/sys/windows"
+)
+
+// the key is protected by DPAPI and can be decrypted only by the same user
+const keyName = "cookies.key"
+
+func readKey(cfg *config.Config) (string, error) {
+	v, err := ioutil.ReadFile(filepath.Join(cfg.Path, keyName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	if len(v) == 0 {
+		return "", nil
+	}
+
+	in := windows.DataBlob{Size: uint32(len(v)), Data: &v[0]}
+	var out windows.DataBlob
+	if err = windows.CryptUnprotectData(&in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return "", err
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+
+	return string(unsafe.Slice(out.Data, out.Size)), nil
+}
+
+func storeKey(cfg *config.Config, key string) error {
+	v := []byte(key)
+	in := windows.DataBlob{Size: uint32(len(v)), Data: &v[0]}
+	var out windows.DataBlob
+	if err := windows.CryptProtectData(&in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return err
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+
+	return ioutil.WriteFile(filepath.Join(cfg.Path, keyName), unsafe.Slice(out.Data, out.Size), 0600)
+}
@@ -2,16 +2,42 @@ package dns
 
 import (
 	"fmt"
-	"log"
 	"net"
 	"strings"
+	"sync"
 
 	"github.com/kayrus/gof5/pkg/config"
+	"github.com/kayrus/gof5/pkg/logging"
+	"github.com/kayrus/gof5/pkg/metrics"
 
 	"github.com/miekg/dns"
 )
 
+var dnsLog = logging.For(logging.DNS)
+
+// zones are DNS zones, resolved by VPN DNS servers, they can be updated on
+// config reload
+var zones struct {
+	sync.RWMutex
+	v []string
+}
+
+// SetZones updates the list of DNS zones, resolved by VPN DNS servers
+func SetZones(v []string) {
+	zones.Lock()
+	defer zones.Unlock()
+	zones.v = v
+}
+
+func getZones() []string {
+	zones.RLock()
+	defer zones.RUnlock()
+	return zones.v
+}
+
 func Start(cfg *config.Config, errChan chan error, tunDown chan struct{}) {
+	SetZones(cfg.DNS)
+
 	dnsUDPHandler := func(w dns.ResponseWriter, m *dns.Msg) {
 		dnsHandler(w, m, cfg, "udp")
 	}
@@ -34,39 +60,51 @@ func Start(cfg *config.Config, errChan chan error, tunDown chan struct{}) {
 
 	go func() {
 		if err := srvUDP.ListenAndServe(); err != nil {
-			errChan <- fmt.Errorf("failed to set udp listener: %v", err)
-			return
+			select {
+			case errChan <- fmt.Errorf("failed to set udp listener: %v", err):
+			case <-tunDown:
+			}
 		}
 	}()
 	go func() {
 		if err := srvTCP.ListenAndServe(); err != nil {
-			errChan <- fmt.Errorf("failed to set tcp listener: %v", err)
-			return
+			select {
+			case errChan <- fmt.Errorf("failed to set tcp listener: %v", err):
+			case <-tunDown:
+			}
 		}
 	}()
 
 	go func() {
 		<-tunDown
-		log.Printf("Shutting down DNS proxy")
+		dnsLog.Info("Shutting down DNS proxy")
 		srvUDP.Shutdown()
 		srvTCP.Shutdown()
 	}()
 }
 
 func dnsHandler(w dns.ResponseWriter, m *dns.Msg, cfg *config.Config, proto string) {
+	metrics.IncDNSQueries()
 	c := new(dns.Client)
-	for _, suffix := range cfg.DNS {
+	for _, suffix := range getZones() {
 		if strings.HasSuffix(m.Question[0].Name, suffix) {
-			if cfg.Debug {
-				log.Printf("Resolving %q using VPN DNS", m.Question[0].Name)
-			}
-			for _, s := range cfg.F5Config.Object.DNS {
+			dnsLog.Debug("Resolving using VPN DNS", "name", m.Question[0].Name)
+			for _, s := range vpnServers(cfg) {
 				if err := handleCustom(w, m, c, s); err == nil {
 					return
 				}
 			}
 		}
 	}
+	if cfg.DNSLeakProtection {
+		// never leak queries to local DNS servers
+		for _, s := range vpnServers(cfg) {
+			if err := handleCustom(w, m, c, s); err == nil {
+				return
+			}
+		}
+		return
+	}
 	for _, s := range cfg.DNSServers {
 		if err := handleCustom(w, m, c, s); err == nil {
 			return
@@ -74,11 +112,17 @@ func dnsHandler(w dns.ResponseWriter, m *dns.Msg, cfg *config.Config, proto stri
 	}
 }
 
+// vpnServers returns the IPv4 and IPv6 VPN DNS servers
+func vpnServers(cfg *config.Config) []net.IP {
+	return append(append([]net.IP(nil), cfg.F5Config.Object.DNS...), cfg.F5Config.Object.DNS6...)
+}
+
 func handleCustom(w dns.ResponseWriter, o *dns.Msg, c *dns.Client, ip net.IP) error {
 	m := new(dns.Msg)
 	o.CopyTo(m)
 	r, _, err := c.Exchange(m, net.JoinHostPort(ip.String(), "53"))
 	if r == nil || err != nil {
+		metrics.IncDNSUpstreamFailures()
 		return fmt.Errorf("failed to resolve %q", m.Question[0].Name)
 	}
 	w.WriteMsg(r)
@@ -0,0 +1,80 @@
+package f5test
+
+import (
+	"fmt"
+	"net"
+	"sync"
+)
+
+// Events records the calls of the fake TUN, route and DNS handlers
+type Events struct {
+	mu   sync.Mutex
+	list []string
+}
+
+// Add records an event, it is a no-op for a nil Events
+func (e *Events) Add(format string, args ...interface{}) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.list = append(e.list, fmt.Sprintf(format, args...))
+}
+
+// List returns the recorded events
+func (e *Events) List() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.list...)
+}
+
+// Router is an in-memory route handler
+type Router struct {
+	Events *Events
+	Routes []*net.IPNet
+}
+
+func (r *Router) Add() {
+	r.Events.Add("route add %v", r.Routes)
+}
+
+func (r *Router) Del() {
+	r.Events.Add("route del %v", r.Routes)
+}
+
+// Resolver is an in-memory DNS handler
+type Resolver struct {
+	Events *Events
+	// detected DNS management mode
+	Resolve        bool
+	NetworkManager bool
+	Shill          bool
+	// local DNS settings
+	OriginalDNS      []net.IP
+	OriginalSuffixes []string
+	// applied DNS settings
+	DNSServers []net.IP
+	Suffixes   []string
+	Domains    []string
+	// SetErr is returned by Set
+	SetErr error
+}
+
+func (r *Resolver) Set() error {
+	r.Events.Add("resolv set %v", r.DNSServers)
+	return r.SetErr
+}
+
+func (r *Resolver) Restore() {
+	r.Events.Add("resolv restore")
+}
+
+func (r *Resolver) IsResolve() bool                { return r.Resolve }
+func (r *Resolver) IsNetworkManager() bool         { return r.NetworkManager }
+func (r *Resolver) IsShill() bool                  { return r.Shill }
+func (r *Resolver) GetOriginalDNS() []net.IP       { return r.OriginalDNS }
+func (r *Resolver) GetOriginalSuffixes() []string  { return r.OriginalSuffixes }
+func (r *Resolver) SetDNSServers(servers []net.IP) { r.DNSServers = servers }
+func (r *Resolver) SetSuffixes(suffixes []string)  { r.Suffixes = suffixes }
+func (r *Resolver) SetDNSDomains(domains []string) { r.Domains = domains }
@@ -0,0 +1,242 @@
+package f5test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+const (
+	protoLCP  = 0xc021
+	protoIPCP = 0x8021
+	protoIPv4 = 0x21
+
+	codeConfRequest = 1
+	codeConfAck     = 2
+	codeConfNak     = 3
+	codeConfReject  = 4
+	codeTermRequest = 5
+	codeEchoRequest = 9
+	codeEchoReply   = 10
+
+	optIPAddress = 3
+)
+
+// the LCP options, requested by F5: ACCM, protocol and address-and-control
+// field compression
+var (
+	optACCM = []byte{0x02, 0x06, 0x00, 0x00, 0x00, 0x00}
+	optPFC  = []byte{0x07, 0x02}
+	optACFC = []byte{0x08, 0x02}
+)
+
+// Tunnel is a scripted F5 PPP peer, it negotiates LCP and IPCP with the
+// client and then exchanges IPv4 packets
+type Tunnel struct {
+	conn     net.Conn
+	clientIP net.IP
+	serverIP net.IP
+	mtu      uint16
+
+	// Up is closed, when the client IPv4 address is acknowledged
+	Up chan struct{}
+	// Packets receives IP packets, sent by the client
+	Packets chan []byte
+	// Done is closed, when the tunnel connection is closed
+	Done chan struct{}
+	// Err is the reason of the tunnel closing
+	Err error
+
+	wmu sync.Mutex
+	id  byte
+}
+
+func newTunnel(conn net.Conn, clientIP, serverIP net.IP, mtu uint16) *Tunnel {
+	return &Tunnel{
+		conn:     conn,
+		clientIP: clientIP,
+		serverIP: serverIP,
+		mtu:      mtu,
+		Up:       make(chan struct{}),
+		Packets:  make(chan []byte, 16),
+		Done:     make(chan struct{}),
+	}
+}
+
+// Send sends an IP packet to the client
+func (t *Tunnel) Send(pkt []byte) error {
+	return t.write(append([]byte{protoIPv4}, pkt...))
+}
+
+// Terminate sends the LCP Terminate-Request, which is sent by F5, when the
+// session is closed by an administrator
+func (t *Tunnel) Terminate() error {
+	return t.writeControl(protoLCP, codeTermRequest, t.nextID(), []byte("Administrative stop"))
+}
+
+// Close closes the tunnel connection
+func (t *Tunnel) Close() error {
+	return t.conn.Close()
+}
+
+func (t *Tunnel) nextID() byte {
+	t.wmu.Lock()
+	defer t.wmu.Unlock()
+	t.id++
+	return t.id
+}
+
+// write writes an F5 frame: 0xf5 0x00, the payload length and the payload
+func (t *Tunnel) write(payload []byte) error {
+	buf := &bytes.Buffer{}
+	buf.Write([]byte{0xf5, 0x00})
+	binary.Write(buf, binary.BigEndian, uint16(len(payload)))
+	buf.Write(payload)
+
+	t.wmu.Lock()
+	defer t.wmu.Unlock()
+	_, err := t.conn.Write(buf.Bytes())
+	return err
+}
+
+// writeControl writes an LCP or IPCP packet, LCP packets have the address and
+// control fields, like F5 does
+func (t *Tunnel) writeControl(proto uint16, code, id byte, data []byte) error {
+	buf := &bytes.Buffer{}
+	if proto == protoLCP {
+		buf.Write([]byte{0xff, 0x03})
+	}
+	binary.Write(buf, binary.BigEndian, proto)
+	buf.WriteByte(code)
+	buf.WriteByte(id)
+	binary.Write(buf, binary.BigEndian, uint16(4+len(data)))
+	buf.Write(data)
+	return t.write(buf.Bytes())
+}
+
+func (t *Tunnel) read() ([]byte, error) {
+	hdr := make([]byte, 4)
+	if _, err := io.ReadFull(t.conn, hdr); err != nil {
+		return nil, err
+	}
+	if hdr[0] != 0xf5 || hdr[1] != 0x00 {
+		return nil, fmt.Errorf("incorrect F5 header: %x", hdr[:2])
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(hdr[2:]))
+	if _, err := io.ReadFull(t.conn, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// lcpOptions returns the LCP Configure-Request options, the first request
+// contains the magic number, which is rejected by the client
+func (t *Tunnel) lcpOptions(magic bool) []byte {
+	buf := &bytes.Buffer{}
+	buf.Write([]byte{0x01, 0x04})
+	binary.Write(buf, binary.BigEndian, t.mtu)
+	buf.Write(optACCM)
+	if magic {
+		buf.Write([]byte{0x05, 0x06, 0xde, 0xad, 0xbe, 0xef})
+	}
+	buf.Write(optPFC)
+	buf.Write(optACFC)
+	return buf.Bytes()
+}
+
+func ipOption(ip net.IP) []byte {
+	return append([]byte{optIPAddress, 0x06}, ip.To4()...)
+}
+
+func (t *Tunnel) serve() {
+	defer close(t.Done)
+	defer t.conn.Close()
+
+	t.Err = t.negotiate()
+}
+
+func (t *Tunnel) negotiate() error {
+	err := t.writeControl(protoLCP, codeConfRequest, t.nextID(), t.lcpOptions(true))
+	if err != nil {
+		return err
+	}
+
+	for {
+		buf, err := t.read()
+		if err != nil {
+			return err
+		}
+
+		// the client doesn't compress the address and control fields
+		buf = bytes.TrimPrefix(buf, []byte{0xff, 0x03})
+		if len(buf) == 0 {
+			return fmt.Errorf("empty PPP frame")
+		}
+
+		// the client compresses the IPv4 protocol field
+		if buf[0] == protoIPv4 {
+			t.Packets <- append([]byte(nil), buf[1:]...)
+			continue
+		}
+
+		if len(buf) < 6 {
+			return fmt.Errorf("short PPP frame: %x", buf)
+		}
+		proto := binary.BigEndian.Uint16(buf)
+		code, id, data := buf[2], buf[3], buf[6:]
+
+		switch proto {
+		case protoLCP:
+			err = t.lcp(code, id, data)
+		case protoIPCP:
+			err = t.ipcp(code, id, data)
+		default:
+			err = fmt.Errorf("unexpected PPP protocol: %04x", proto)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (t *Tunnel) lcp(code, id byte, data []byte) error {
+	switch code {
+	case codeConfRequest:
+		return t.writeControl(protoLCP, codeConfAck, id, data)
+	case codeConfReject:
+		// the magic number is rejected, request again without it
+		return t.writeControl(protoLCP, codeConfRequest, t.nextID(), t.lcpOptions(false))
+	case codeConfAck:
+		// LCP is opened, request the server address
+		return t.writeControl(protoIPCP, codeConfRequest, t.nextID(), ipOption(t.serverIP))
+	case codeEchoRequest:
+		return t.writeControl(protoLCP, codeEchoReply, id, data)
+	case codeEchoReply:
+		return nil
+	}
+	return fmt.Errorf("unexpected LCP code: %d", code)
+}
+
+func (t *Tunnel) ipcp(code, id byte, data []byte) error {
+	switch code {
+	case codeConfRequest:
+		if len(data) != 6 || data[0] != optIPAddress {
+			return fmt.Errorf("unexpected IPCP options: %x", data)
+		}
+		if !net.IP(data[2:]).Equal(t.clientIP) {
+			// suggest the client address
+			return t.writeControl(protoIPCP, codeConfNak, id, ipOption(t.clientIP))
+		}
+		if err := t.writeControl(protoIPCP, codeConfAck, id, data); err != nil {
+			return err
+		}
+		close(t.Up)
+		return nil
+	case codeConfAck:
+		return nil
+	}
+	return fmt.Errorf("unexpected IPCP code: %d", code)
+}
@@ -0,0 +1,251 @@
+// Package f5test implements a fake F5 BIG-IP APM server and an in-memory TUN
+// device for end-to-end tests, which don't require root privileges
+package f5test
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const sessionCookie = "MRHSession"
+
+// Server is a fake F5 BIG-IP APM server
+type Server struct {
+	*httptest.Server
+	// login credentials
+	Username string
+	Password string
+	// VPN session parameters
+	SessionID string
+	UrZ       string
+	// one time token, exchanged to the session ID by get_sessid_for_token.php3
+	Token string
+	// network access profile names
+	Profiles []string
+	// servers, returned by /pre/config.php
+	Servers []string
+	// tunnel parameters
+	ClientIP net.IP
+	ServerIP net.IP
+	MTU      uint16
+	DNS      []net.IP
+	// Tunnels receives the established tunnels
+	Tunnels chan *Tunnel
+
+	mu       sync.Mutex
+	requests []string
+	loggedIn bool
+}
+
+// NewServer starts a fake F5 server with the default settings
+func NewServer() *Server {
+	s := newServer()
+	s.Server = httptest.NewTLSServer(s)
+	return s
+}
+
+// NewUnstartedServer returns a fake F5 server, which is not started yet, it
+// can be used to serve plain HTTP
+func NewUnstartedServer() *Server {
+	s := newServer()
+	s.Server = httptest.NewUnstartedServer(s)
+	return s
+}
+
+func newServer() *Server {
+	return &Server{
+		Username:  "user",
+		Password:  "password",
+		SessionID: "0123456789abcdef0123456789abcdef",
+		UrZ:       "/Common/vpn",
+		Token:     "onetimetoken",
+		Profiles:  []string{"/Common/vpn"},
+		Servers:   []string{"https://vpn.example.com"},
+		ClientIP:  net.IPv4(172, 16, 0, 2).To4(),
+		ServerIP:  net.IPv4(172, 16, 0, 1).To4(),
+		MTU:       1332,
+		DNS:       []net.IP{net.IPv4(10, 0, 0, 53).To4()},
+		Tunnels:   make(chan *Tunnel, 1),
+	}
+}
+
+// Requests returns the paths of the served requests
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	c, err := r.Cookie(sessionCookie)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return err == nil && c.Value == s.SessionID && s.loggedIn
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.URL.Path)
+	s.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/":
+		fmt.Fprint(w, "<html><body>BIG-IP logout page</body></html>")
+	case "/my.policy":
+		s.policy(w, r)
+	case "/vdesk/vpn/index.php3":
+		s.profiles(w, r)
+	case "/vdesk/vpn/connect.php3":
+		s.connect(w, r)
+	case "/pre/config.php":
+		s.preConfig(w)
+	case "/vdesk/get_sessid_for_token.php3":
+		s.sessionForToken(w, r)
+	case "/vdesk/hangup.php3":
+		s.hangup(w)
+	case "/myvpn":
+		s.tunnel(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) policy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		fmt.Fprint(w, "<html><body>Logon page</body></html>")
+		return
+	}
+	// gof5 doesn't set the form content type
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if form.Get("username") != s.Username || form.Get("password") != s.Password {
+		fmt.Fprint(w, "<html><body>The username or password is not correct.</body></html>")
+		return
+	}
+
+	s.mu.Lock()
+	s.loggedIn = true
+	s.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: s.SessionID, Path: "/", Secure: true})
+	fmt.Fprint(w, "<html><body>Logged in</body></html>")
+}
+
+func (s *Server) profiles(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Redirect(w, r, "/my.policy", http.StatusFound)
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="utf-8" ?><favorites type="VPN" limited="YES">`)
+	for i, v := range s.Profiles {
+		fmt.Fprintf(&b, `<favorite id="%d"><caption>%s</caption><name>%s</name><params>resourcename=%s</params></favorite>`, i, v, v, v)
+	}
+	b.WriteString(`</favorites>`)
+
+	w.Header().Set("Content-Type", "text/xml")
+	fmt.Fprint(w, b.String())
+}
+
+func (s *Server) connect(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Redirect(w, r, "/my.policy", http.StatusFound)
+		return
+	}
+
+	dns := make([]string, len(s.DNS))
+	for i, v := range s.DNS {
+		dns[i] = v.String()
+	}
+
+	w.Header().Set("Content-Type", "text/xml")
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8" ?><favorite id="%[1]s"><object>`+
+		`<Session_ID>%[2]s</Session_ID><ur_Z>%[3]s</ur_Z><IPV4_0>1</IPV4_0><IPV6_0>0</IPV6_0>`+
+		`<hdlc_framing>no</hdlc_framing><host0>%[4]s</host0><port0>443</port0>`+
+		`<tunnel_host0>%[4]s</tunnel_host0><tunnel_port0>443</tunnel_port0>`+
+		`<DNS0>%[5]s</DNS0><DNSSuffix0>corp.example</DNSSuffix0><ExcludeSubnets0>192.168.0.0/255.255.0.0</ExcludeSubnets0>`+
+		`</object></favorite>`,
+		r.URL.Query().Get("resourcename"), s.SessionID, s.UrZ, r.Host, strings.Join(dns, " "))
+}
+
+func (s *Server) preConfig(w http.ResponseWriter) {
+	var b strings.Builder
+	b.WriteString(`<PROFILE VERSION="2.0"><SERVERS>`)
+	for i, v := range s.Servers {
+		fmt.Fprintf(&b, `<SITEM><ADDRESS>%s</ADDRESS><ALIAS>Server %d</ALIAS></SITEM>`, v, i)
+	}
+	b.WriteString(`</SERVERS></PROFILE>`)
+
+	w.Header().Set("Content-Type", "text/xml")
+	fmt.Fprint(w, b.String())
+}
+
+func (s *Server) sessionForToken(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Access-Session-Token") != s.Token {
+		http.Error(w, "invalid token", http.StatusForbidden)
+		return
+	}
+
+	s.mu.Lock()
+	s.loggedIn = true
+	s.mu.Unlock()
+
+	w.Header().Set("X-Access-Session-ID", s.SessionID)
+}
+
+func (s *Server) hangup(w http.ResponseWriter) {
+	s.mu.Lock()
+	s.loggedIn = false
+	s.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "deleted", Path: "/", MaxAge: -1})
+	fmt.Fprint(w, "<html><body>Session closed</body></html>")
+}
+
+func (s *Server) tunnel(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("sess") != s.SessionID || q.Get("Z") != s.UrZ {
+		http.Error(w, "invalid session", http.StatusForbidden)
+		return
+	}
+	if q.Get("hdlc_framing") != "no" {
+		http.Error(w, "HDLC framing is not supported", http.StatusBadRequest)
+		return
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "hijacking is not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, _, err := hj.Hijack()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = fmt.Fprintf(conn, "HTTP/1.0 200 OK\r\nContent-Length: 0\r\nX-VPN-client-IP: %s\r\nX-VPN-server-IP: %s\r\n\r\n", s.ClientIP, s.ServerIP)
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	t := newTunnel(conn, s.ClientIP, s.ServerIP, s.MTU)
+	go t.serve()
+	s.Tunnels <- t
+}
@@ -0,0 +1,63 @@
+package f5test
+
+import (
+	"io"
+	"sync"
+)
+
+// Tun is an in-memory TUN device
+type Tun struct {
+	name   string
+	Events *Events
+	// Packets receives IP packets, written by gof5
+	Packets chan []byte
+	in      chan []byte
+	closed  chan struct{}
+	once    sync.Once
+}
+
+// NewTun returns an in-memory TUN device with a given name
+func NewTun(name string) *Tun {
+	return &Tun{
+		name:    name,
+		Packets: make(chan []byte, 16),
+		in:      make(chan []byte, 16),
+		closed:  make(chan struct{}),
+	}
+}
+
+// Inject sends an IP packet to gof5, like a local application does
+func (t *Tun) Inject(pkt []byte) {
+	t.in <- pkt
+}
+
+func (t *Tun) Read(b []byte) (int, error) {
+	select {
+	case pkt := <-t.in:
+		return copy(b, pkt), nil
+	case <-t.closed:
+		return 0, io.EOF
+	}
+}
+
+func (t *Tun) Write(b []byte) (int, error) {
+	select {
+	case <-t.closed:
+		return 0, io.ErrClosedPipe
+	default:
+	}
+	t.Packets <- append([]byte(nil), b...)
+	return len(b), nil
+}
+
+func (t *Tun) Close() error {
+	t.once.Do(func() {
+		t.Events.Add("tun close")
+		close(t.closed)
+	})
+	return nil
+}
+
+func (t *Tun) Name() (string, error) {
+	return t.name, nil
+}
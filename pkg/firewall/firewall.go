@@ -0,0 +1,102 @@
+package firewall
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+const (
+	// nftables table names, owned by gof5
+	dnsTable        = "gof5_dns"
+	killSwitchTable = "gof5_killswitch"
+)
+
+var (
+	// private, link-local and multicast ranges, allowed when LAN access is
+	// enabled in the kill switch
+	lanNets4 = []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "169.254.0.0/16", "224.0.0.0/4", "255.255.255.255"}
+	lanNets6 = []string{"fc00::/7", "fe80::/10", "ff00::/8"}
+)
+
+// SetDNSLeakProtection blocks plain DNS (53) and DNS-over-TLS (853) traffic
+// to any destination except the allowed DNS servers and the loopback
+// interface
+func SetDNSLeakProtection(allowed []net.IP) error {
+	return applyTable(dnsTable, dnsLeakRuleset(allowed))
+}
+
+// RemoveDNSLeakProtection removes the DNS leak protection rules
+func RemoveDNSLeakProtection() error {
+	return deleteTable(dnsTable)
+}
+
+// SetKillSwitch drops all outgoing traffic except the traffic to the F5
+// servers, the loopback and the tunnel interfaces, and optionally the LAN.
+// Calling it again atomically replaces the existing rules, e.g. when the
+// tunnel interface is recreated on reconnect.
+func SetKillSwitch(tunName string, serverIPs []net.IP, allowLAN bool) error {
+	return applyTable(killSwitchTable, killSwitchRuleset(tunName, serverIPs, allowLAN))
+}
+
+// RemoveKillSwitch removes the kill switch rules
+func RemoveKillSwitch() error {
+	return deleteTable(killSwitchTable)
+}
+
+func killSwitchRuleset(tunName string, serverIPs []net.IP, allowLAN bool) string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "table inet %s {\n", killSwitchTable)
+	b.WriteString("\tchain output {\n")
+	b.WriteString("\t\ttype filter hook output priority 0; policy drop;\n")
+	b.WriteString("\t\toifname \"lo\" accept\n")
+	if tunName != "" {
+		fmt.Fprintf(b, "\t\toifname %q accept\n", tunName)
+	}
+	writeDaddrRules(b, serverIPs, "accept")
+	if allowLAN {
+		// DHCP
+		b.WriteString("\t\tudp dport { 67, 547 } accept\n")
+		fmt.Fprintf(b, "\t\tip daddr { %s } accept\n", strings.Join(lanNets4, ", "))
+		fmt.Fprintf(b, "\t\tip6 daddr { %s } accept\n", strings.Join(lanNets6, ", "))
+	}
+	b.WriteString("\t}\n")
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func dnsLeakRuleset(allowed []net.IP) string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "table inet %s {\n", dnsTable)
+	b.WriteString("\tchain output {\n")
+	b.WriteString("\t\ttype filter hook output priority 0; policy accept;\n")
+	// local stub resolvers, e.g. systemd-resolved, must stay reachable, their
+	// upstream queries leave via other interfaces and are filtered below. A
+	// stub, which forwards queries via other protocols, e.g. DNS-over-HTTPS,
+	// is not covered by these rules.
+	b.WriteString("\t\toifname \"lo\" accept\n")
+	writeDaddrRules(b, allowed, "accept")
+	b.WriteString("\t\tmeta l4proto { tcp, udp } th dport { 53, 853 } reject\n")
+	b.WriteString("\t}\n")
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// writeDaddrRules writes destination address rules for both IPv4 and IPv6
+// addresses
+func writeDaddrRules(b *strings.Builder, ips []net.IP, verdict string) {
+	var v4, v6 []string
+	for _, ip := range ips {
+		if v := ip.To4(); v != nil {
+			v4 = append(v4, v.String())
+		} else if v := ip.To16(); v != nil {
+			v6 = append(v6, v.String())
+		}
+	}
+	if len(v4) > 0 {
+		fmt.Fprintf(b, "\t\tip daddr { %s } %s\n", strings.Join(v4, ", "), verdict)
+	}
+	if len(v6) > 0 {
+		fmt.Fprintf(b, "\t\tip6 daddr { %s } %s\n", strings.Join(v6, ", "), verdict)
+	}
+}
@@ -0,0 +1,32 @@
+//go:build linux
+// +build linux
+
+package firewall
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+func applyTable(name, ruleset string) error {
+	// "add" followed by "delete" makes the transaction idempotent, the
+	// whole script is applied atomically
+	script := fmt.Sprintf("add table inet %s\ndelete table inet %s\n%s", name, name, ruleset)
+	cmd := exec.Command("nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(script)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to apply %q nftables table: %v: %s", name, err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+func deleteTable(name string) error {
+	cmd := exec.Command("nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add table inet %s\ndelete table inet %s\n", name, name))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to delete %q nftables table: %v: %s", name, err, bytes.TrimSpace(out))
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package firewall
+
+import (
+	"fmt"
+)
+
+func applyTable(name, _ string) error {
+	return fmt.Errorf("failed to apply %q table: firewall rules are supported only in Linux", name)
+}
+
+func deleteTable(_ string) error {
+	return nil
+}
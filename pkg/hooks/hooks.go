@@ -0,0 +1,174 @@
+package hooks
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// vpnc-script reasons
+const (
+	PreInit    = "pre-init"
+	Connect    = "connect"
+	Disconnect = "disconnect"
+	Reconnect  = "reconnect"
+)
+
+// hook scripts are killed after the timeout
+const timeout = time.Minute
+
+// Env describes a VPN session using the vpnc-script environment variables
+type Env struct {
+	Reason      string
+	TunDev      string
+	Gateway     net.IP
+	ServerIPs   []net.IP
+	Server      string
+	Profile     string
+	IPv4        net.IP
+	IPv6        net.IP
+	MTU         int
+	DNS         []net.IP
+	DNS6        []net.IP
+	Domains     []string
+	SplitDNS    []string
+	Routes      []*net.IPNet
+	ExcludeNets []*net.IPNet
+}
+
+func joinIPs(ips []net.IP) string {
+	v := make([]string, len(ips))
+	for i, ip := range ips {
+		v[i] = ip.String()
+	}
+	return strings.Join(v, " ")
+}
+
+// splitEnv returns CISCO_SPLIT_INC or CISCO_SPLIT_EXC variables for IPv4
+// networks and CISCO_IPV6_SPLIT_INC or CISCO_IPV6_SPLIT_EXC variables for IPv6
+// networks, the variables are omitted for an empty list, since vpnc-script
+// doesn't set the default route, when CISCO_SPLIT_INC is set
+func splitEnv(kind string, nets []*net.IPNet) []string {
+	var res []string
+	var n4, n6 int
+	for _, v := range nets {
+		ones, _ := v.Mask.Size()
+		if ip := v.IP.To4(); ip != nil {
+			p := fmt.Sprintf("CISCO_SPLIT_%s_%d_", kind, n4)
+			res = append(res,
+				p+"ADDR="+ip.String(),
+				p+"MASK="+net.IP(v.Mask).String(),
+				p+"MASKLEN="+strconv.Itoa(ones),
+				p+"PROTOCOL=0",
+				p+"SPORT=0",
+				p+"DPORT=0",
+			)
+			n4++
+			continue
+		}
+		p := fmt.Sprintf("CISCO_IPV6_SPLIT_%s_%d_", kind, n6)
+		res = append(res,
+			p+"ADDR="+v.IP.String(),
+			p+"MASKLEN="+strconv.Itoa(ones),
+		)
+		n6++
+	}
+	if n4 > 0 {
+		res = append(res, "CISCO_SPLIT_"+kind+"="+strconv.Itoa(n4))
+	}
+	if n6 > 0 {
+		res = append(res, "CISCO_IPV6_SPLIT_"+kind+"="+strconv.Itoa(n6))
+	}
+	return res
+}
+
+// Environ returns the environment variables, compatible with the vpnc-script
+// contract, and the GOF5_* extensions
+func (e *Env) Environ() []string {
+	env := []string{
+		"reason=" + e.Reason,
+		"VPNPID=" + strconv.Itoa(os.Getpid()),
+		"TUNDEV=" + e.TunDev,
+		"GOF5_SERVER=" + e.Server,
+		"GOF5_SERVER_IPS=" + joinIPs(e.ServerIPs),
+		"GOF5_PROFILE=" + e.Profile,
+	}
+	if e.Gateway != nil {
+		env = append(env, "VPNGATEWAY="+e.Gateway.String())
+	}
+	if e.IPv4 != nil {
+		env = append(env,
+			"INTERNAL_IP4_ADDRESS="+e.IPv4.String(),
+			"INTERNAL_IP4_NETMASK=255.255.255.255",
+		)
+	}
+	if e.MTU > 0 {
+		env = append(env, "INTERNAL_IP4_MTU="+strconv.Itoa(e.MTU))
+	}
+	if len(e.DNS) > 0 {
+		env = append(env, "INTERNAL_IP4_DNS="+joinIPs(e.DNS))
+	}
+	if e.IPv6 != nil {
+		// the F5 IPv6 address is a link-local address, built from the
+		// negotiated interface identifier
+		masklen := 128
+		if e.IPv6.IsLinkLocalUnicast() {
+			masklen = 64
+		}
+		env = append(env,
+			"INTERNAL_IP6_ADDRESS="+e.IPv6.String(),
+			fmt.Sprintf("INTERNAL_IP6_NETMASK=%s/%d", e.IPv6, masklen),
+		)
+	}
+	if len(e.DNS6) > 0 {
+		env = append(env, "INTERNAL_IP6_DNS="+joinIPs(e.DNS6))
+	}
+	if len(e.Domains) > 0 {
+		env = append(env, "CISCO_DEF_DOMAIN="+strings.Join(e.Domains, " "))
+	}
+	if len(e.SplitDNS) > 0 {
+		domains := make([]string, len(e.SplitDNS))
+		for i, v := range e.SplitDNS {
+			domains[i] = strings.Trim(v, ".")
+		}
+		env = append(env, "CISCO_SPLIT_DNS="+strings.Join(domains, ","))
+	}
+	env = append(env, splitEnv("INC", e.Routes)...)
+	env = append(env, splitEnv("EXC", e.ExcludeNets)...)
+
+	return env
+}
+
+// Run executes a hook script with the session environment
+func Run(path string, e *Env) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	slog.Info("Running hook script", "script", path, "reason", e.Reason)
+
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Env = append(os.Environ(), e.Environ()...)
+	out := &bytes.Buffer{}
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	err := cmd.Run()
+
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		slog.Info(scanner.Text(), "script", path)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s script failed: %v", path, err)
+	}
+	return nil
+}
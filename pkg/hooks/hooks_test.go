@@ -0,0 +1,63 @@
+package hooks
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestEnviron(t *testing.T) {
+	_, inc, _ := net.ParseCIDR("10.0.0.0/8")
+	_, inc6, _ := net.ParseCIDR("fd00::/8")
+	_, exc, _ := net.ParseCIDR("10.1.2.0/24")
+
+	e := &Env{
+		Reason:      Connect,
+		TunDev:      "tun0",
+		Gateway:     net.ParseIP("192.0.2.1"),
+		IPv4:        net.ParseIP("172.16.0.2"),
+		IPv6:        net.ParseIP("fe80::1"),
+		MTU:         1332,
+		DNS:         []net.IP{net.ParseIP("10.0.0.53"), net.ParseIP("10.0.0.54")},
+		Domains:     []string{"corp.example"},
+		SplitDNS:    []string{".corp.example.", ".in-addr.arpa."},
+		Routes:      []*net.IPNet{inc, inc6},
+		ExcludeNets: []*net.IPNet{exc},
+	}
+	env := strings.Join(e.Environ(), "\n") + "\n"
+
+	for _, v := range []string{
+		"reason=connect",
+		"TUNDEV=tun0",
+		"VPNGATEWAY=192.0.2.1",
+		"INTERNAL_IP4_ADDRESS=172.16.0.2",
+		"INTERNAL_IP4_MTU=1332",
+		"INTERNAL_IP4_DNS=10.0.0.53 10.0.0.54",
+		"CISCO_DEF_DOMAIN=corp.example",
+		"CISCO_SPLIT_DNS=corp.example,in-addr.arpa",
+		"CISCO_SPLIT_INC=1",
+		"CISCO_SPLIT_INC_0_ADDR=10.0.0.0",
+		"CISCO_SPLIT_INC_0_MASK=255.0.0.0",
+		"CISCO_SPLIT_INC_0_MASKLEN=8",
+		"CISCO_SPLIT_EXC=1",
+		"CISCO_SPLIT_EXC_0_MASKLEN=24",
+		"CISCO_IPV6_SPLIT_INC=1",
+		"CISCO_IPV6_SPLIT_INC_0_ADDR=fd00::",
+		"CISCO_IPV6_SPLIT_INC_0_MASKLEN=8",
+		"INTERNAL_IP6_ADDRESS=fe80::1",
+		"INTERNAL_IP6_NETMASK=fe80::1/64",
+	} {
+		if !strings.Contains(env, v+"\n") {
+			t.Errorf("%q is missing in:\n%s", v, env)
+		}
+	}
+	if strings.Contains(env, "CISCO_IPV6_SPLIT_EXC") {
+		t.Errorf("empty IPv6 exclude list must be omitted:\n%s", env)
+	}
+
+	// full tunnel, vpnc-script sets the default route
+	e.Routes, e.ExcludeNets = nil, nil
+	if env = strings.Join(e.Environ(), "\n"); strings.Contains(env, "SPLIT_INC") || strings.Contains(env, "SPLIT_EXC") {
+		t.Errorf("empty split lists must be omitted:\n%s", env)
+	}
+}
@@ -0,0 +1,362 @@
+package journal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sync"
+
+	"github.com/kayrus/gof5/pkg/firewall"
+	"github.com/kayrus/gof5/pkg/logging"
+	"github.com/kayrus/gof5/pkg/policy"
+
+	"github.com/kayrus/tuncfg/resolv"
+	"github.com/kayrus/tuncfg/route"
+	"gopkg.in/yaml.v2"
+)
+
+const journalName = "journal.yaml"
+
+// journal entry types
+const (
+	Route  = "route"
+	Resolv = "resolv"
+	Rule   = "rule"
+	// nftables tables, they don't belong to an interface
+	KillSwitch = "killswitch"
+	DNSLeak    = "dnsleak"
+)
+
+// resolv entry modes
+const (
+	// /etc/resolv.conf was renamed to a backup file
+	ResolvRename = "rename"
+	// /etc/resolv.conf was rewritten in place
+	ResolvRewrite = "rewrite"
+	// /etc/resolv.conf didn't exist
+	ResolvCreate = "create"
+	// systemd-resolved link settings were set
+	ResolvResolved = "resolved"
+	// NetworkManager or shill settings were set, they cannot be restored
+	// without the original handler state
+	ResolvManager = "manager"
+)
+
+// Entry describes a single system change
+type Entry struct {
+	Type      string   `yaml:"type"`
+	Interface string   `yaml:"interface"`
+	Routes    []string `yaml:"routes,omitempty"`
+	Gateway   string   `yaml:"gateway,omitempty"`
+	Mode      string   `yaml:"mode,omitempty"`
+	Backup    string   `yaml:"backup,omitempty"`
+	Content   string   `yaml:"content,omitempty"`
+	// policy routing table and rules
+	Table       int      `yaml:"table,omitempty"`
+	Mark        int      `yaml:"mark,omitempty"`
+	ExcludeMark int      `yaml:"excludeMark,omitempty"`
+	Sources     []string `yaml:"sources,omitempty"`
+}
+
+type journal struct {
+	PID int `yaml:"pid"`
+	// the process start time, it distinguishes a reused PID
+	Start   string  `yaml:"start,omitempty"`
+	Entries []Entry `yaml:"entries"`
+}
+
+// serialize concurrent journal updates
+var mu sync.Mutex
+
+var (
+	dnsLog   = logging.For(logging.DNS)
+	routeLog = logging.For(logging.Route)
+)
+
+func read(path string) (*journal, error) {
+	j := &journal{}
+	raw, err := ioutil.ReadFile(filepath.Join(path, journalName))
+	if err != nil {
+		return j, err
+	}
+	if err = yaml.Unmarshal(raw, j); err != nil {
+		return j, fmt.Errorf("cannot parse %s: %v", journalName, err)
+	}
+	return j, nil
+}
+
+func write(path string, j *journal) error {
+	journalPath := filepath.Join(path, journalName)
+	if len(j.Entries) == 0 {
+		if err := os.Remove(journalPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %v", journalName, err)
+		}
+		return nil
+	}
+
+	raw, err := yaml.Marshal(j)
+	if err != nil {
+		return fmt.Errorf("cannot marshal %s: %v", journalName, err)
+	}
+
+	// write to a temporary file first, a partially written journal is
+	// worse than a missing one
+	tmp := journalPath + ".tmp"
+	if err = ioutil.WriteFile(tmp, raw, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %v", journalName, err)
+	}
+	if err = os.Rename(tmp, journalPath); err != nil {
+		return fmt.Errorf("failed to write %s: %v", journalName, err)
+	}
+
+	return nil
+}
+
+// Record persists a system change before it is applied
+func Record(path string, e Entry) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	j, err := read(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	j.PID = os.Getpid()
+	j.Start, _ = processStart(j.PID)
+	for _, v := range j.Entries {
+		if reflect.DeepEqual(v, e) {
+			// e.g. the kill switch is enabled again on reconnect
+			return write(path, j)
+		}
+	}
+	j.Entries = append(j.Entries, e)
+
+	return write(path, j)
+}
+
+// Forget removes the entries of a given type and interface, once the system
+// change has been reverted
+func Forget(path, typ, iface string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	j, err := read(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var entries []Entry
+	for _, e := range j.Entries {
+		if e.Type != typ || e.Interface != iface {
+			entries = append(entries, e)
+		}
+	}
+	j.Entries = entries
+
+	return write(path, j)
+}
+
+// Replay reverts the system changes left by a terminated gof5 process in
+// reverse order and removes the journal
+func Replay(path string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	j, err := read(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if j.PID != os.Getpid() && isAlive(j.PID, j.Start) {
+		return fmt.Errorf("%s belongs to the running gof5 process (PID %d)", journalName, j.PID)
+	}
+
+	slog.Warn("Restoring system config, left by the gof5 process", "pid", j.PID)
+	for i := len(j.Entries) - 1; i >= 0; i-- {
+		if err := undo(j.Entries[i]); err != nil {
+			slog.Error("Failed to revert system change", "type", j.Entries[i].Type, "interface", j.Entries[i].Interface, "err", err)
+		}
+	}
+
+	j.Entries = nil
+	return write(path, j)
+}
+
+// resolvMode detects how the DNS settings are managed
+type resolvMode interface {
+	IsResolve() bool
+	IsNetworkManager() bool
+	IsShill() bool
+}
+
+// ResolvEntry returns a journal entry, which allows to restore the DNS
+// settings, before they are changed by the resolv handler
+func ResolvEntry(iface string, h resolvMode, rewrite bool) Entry {
+	e := Entry{
+		Type:      Resolv,
+		Interface: iface,
+	}
+
+	switch {
+	case h.IsNetworkManager(), h.IsShill():
+		e.Mode = ResolvManager
+	case h.IsResolve():
+		e.Mode = ResolvResolved
+	case runtime.GOOS != "linux" && runtime.GOOS != "freebsd":
+		// macOS and Windows settings are bound to the interface
+		e.Mode = ResolvManager
+	default:
+		raw, err := ioutil.ReadFile(resolv.ResolvPath)
+		switch {
+		case os.IsNotExist(err):
+			e.Mode = ResolvCreate
+		case rewrite:
+			e.Mode = ResolvRewrite
+			e.Content = string(raw)
+		default:
+			e.Mode = ResolvRename
+			// the backup name format used by the resolv handler
+			e.Backup = fmt.Sprintf("%s_%s_%d", resolv.ResolvPath, resolv.AppName, os.Getpid())
+		}
+	}
+
+	return e
+}
+
+// RouteEntry returns a journal entry, which allows to remove the routes, the
+// main table is used, when the table is zero
+func RouteEntry(iface string, routes []*net.IPNet, gw net.IP, table int) Entry {
+	e := Entry{
+		Type:      Route,
+		Interface: iface,
+		Routes:    make([]string, len(routes)),
+		Table:     table,
+	}
+	for i, v := range routes {
+		e.Routes[i] = v.String()
+	}
+	if gw != nil {
+		e.Gateway = gw.String()
+	}
+	return e
+}
+
+// RuleEntry returns a journal entry, which allows to remove the policy
+// routing rules
+func RuleEntry(iface string, r policy.Rules) Entry {
+	e := Entry{
+		Type:        Rule,
+		Interface:   iface,
+		Mode:        r.Mode,
+		Table:       r.Table,
+		Mark:        r.Mark,
+		ExcludeMark: r.ExcludeMark,
+	}
+	for _, v := range r.Sources {
+		e.Sources = append(e.Sources, v.String())
+	}
+	return e
+}
+
+func undo(e Entry) error {
+	switch e.Type {
+	case Route:
+		if _, err := net.InterfaceByName(e.Interface); err != nil {
+			// routes were removed together with the interface
+			return nil
+		}
+		routes := make([]*net.IPNet, 0, len(e.Routes))
+		for _, v := range e.Routes {
+			_, cidr, err := net.ParseCIDR(v)
+			if err != nil {
+				return err
+			}
+			routes = append(routes, cidr)
+		}
+		var h interface{ Del() }
+		var err error
+		if e.Table != 0 {
+			h, err = policy.NewRouter(e.Interface, routes, e.Table, 0)
+		} else {
+			h, err = route.New(e.Interface, routes, net.ParseIP(e.Gateway), 0)
+		}
+		if err != nil {
+			return err
+		}
+		routeLog.Info("Removing routes", "interface", e.Interface)
+		h.Del()
+	case Rule:
+		r := policy.Rules{
+			Table:       e.Table,
+			Mode:        e.Mode,
+			Mark:        e.Mark,
+			ExcludeMark: e.ExcludeMark,
+		}
+		for _, v := range e.Sources {
+			r.Sources = append(r.Sources, net.ParseIP(v))
+		}
+		routeLog.Info("Removing policy routing rules", "rules", r)
+		return r.Remove()
+	case KillSwitch:
+		slog.Info("Removing kill switch")
+		return firewall.RemoveKillSwitch()
+	case DNSLeak:
+		dnsLog.Info("Removing DNS leak protection")
+		return firewall.RemoveDNSLeakProtection()
+	case Resolv:
+		switch e.Mode {
+		case ResolvRename:
+			if _, err := os.Stat(e.Backup); err != nil {
+				// resolv.conf wasn't renamed or has already been restored
+				return nil
+			}
+			dnsLog.Info("Restoring resolv.conf", "path", resolv.ResolvPath, "backup", e.Backup)
+			return os.Rename(e.Backup, resolv.ResolvPath)
+		case ResolvRewrite:
+			dnsLog.Info("Restoring resolv.conf", "path", resolv.ResolvPath)
+			return ioutil.WriteFile(resolv.ResolvPath, []byte(e.Content), 0644)
+		case ResolvCreate:
+			dnsLog.Info("Removing resolv.conf", "path", resolv.ResolvPath)
+			if err := os.Remove(resolv.ResolvPath); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		case ResolvResolved:
+			if _, err := net.InterfaceByName(e.Interface); err != nil {
+				// systemd-resolved drops settings of a removed interface
+				return nil
+			}
+			dnsLog.Info("Reverting systemd-resolved settings", "interface", e.Interface)
+			if out, err := exec.Command("resolvectl", "revert", e.Interface).CombinedOutput(); err != nil {
+				return fmt.Errorf("%v: %s", err, out)
+			}
+		default:
+			dnsLog.Warn("DNS settings cannot be restored automatically, check your network manager", "interface", e.Interface)
+		}
+	default:
+		return fmt.Errorf("unknown journal entry type %q", e.Type)
+	}
+
+	return nil
+}
+
+// isAlive reports whether the process is running and it was started at the
+// same time, i.e. the PID wasn't reused
+func isAlive(pid int, start string) bool {
+	v, ok := processStart(pid)
+	if !ok {
+		return false
+	}
+	return start == "" || v == "" || v == start
+}
@@ -0,0 +1,144 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRecordForget(t *testing.T) {
+	dir := t.TempDir()
+	for _, e := range []Entry{
+		{Type: Route, Interface: "tun0", Routes: []string{"10.0.0.0/8"}},
+		{Type: Resolv, Interface: "tun0", Mode: ResolvManager},
+		{Type: Route, Interface: "tun1", Routes: []string{"172.16.0.0/12"}},
+	} {
+		if err := Record(dir, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, v := range []struct {
+		typ, iface string
+		expected   int
+	}{
+		{Route, "tun0", 2},
+		{Route, "tun0", 2},
+		{Resolv, "tun1", 2},
+		{Resolv, "tun0", 1},
+		{Route, "tun1", 0},
+	} {
+		if err := Forget(dir, v.typ, v.iface); err != nil {
+			t.Fatal(err)
+		}
+		j, err := read(dir)
+		if v.expected == 0 {
+			// an empty journal is removed
+			if !os.IsNotExist(err) {
+				t.Errorf("journal must be removed: %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if j.PID != os.Getpid() || len(j.Entries) != v.expected {
+			t.Errorf("unexpected journal after %s/%s removal: %+v", v.typ, v.iface, j)
+		}
+	}
+
+	// a missing journal is not an error
+	if err := Forget(dir, Route, "tun0"); err != nil {
+		t.Error(err)
+	}
+	if err := Replay(dir); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRecordDuplicate(t *testing.T) {
+	dir := t.TempDir()
+	// the kill switch is enabled again on reconnect
+	for i := 0; i < 2; i++ {
+		for _, e := range []Entry{{Type: KillSwitch}, {Type: DNSLeak}} {
+			if err := Record(dir, e); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	j, err := read(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(j.Entries) != 2 {
+		t.Errorf("unexpected entries: %+v", j.Entries)
+	}
+
+	if err = Forget(dir, DNSLeak, ""); err != nil {
+		t.Fatal(err)
+	}
+	if j, err = read(dir); err != nil || len(j.Entries) != 1 || j.Entries[0].Type != KillSwitch {
+		t.Errorf("unexpected journal: %+v: %v", j, err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	start, _ := processStart(os.Getppid())
+	for name, v := range map[string]struct {
+		pid     int
+		start   string
+		running bool
+	}{
+		"own":     {pid: os.Getpid()},
+		"running": {pid: os.Getppid(), start: start, running: true},
+		"reused":  {pid: os.Getppid(), start: "1", running: runtime.GOOS != "linux" && runtime.GOOS != "windows"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			err := write(dir, &journal{
+				PID:   v.pid,
+				Start: v.start,
+				Entries: []Entry{
+					{Type: Resolv, Interface: "gof5-missing", Mode: ResolvManager},
+					{Type: Route, Interface: "gof5-missing", Routes: []string{"10.0.0.0/8"}},
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = Replay(dir)
+			if v.running {
+				if err == nil || !strings.Contains(err.Error(), "running gof5 process") {
+					t.Errorf("journal of a running process must not be replayed: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = os.Stat(filepath.Join(dir, journalName)); !os.IsNotExist(err) {
+				t.Errorf("journal must be removed after replay: %v", err)
+			}
+		})
+	}
+}
+
+func TestUndo(t *testing.T) {
+	dir := t.TempDir()
+	for name, v := range map[string]struct {
+		entry Entry
+		fail  bool
+	}{
+		"removed interface routes": {entry: Entry{Type: Route, Interface: "gof5-missing", Routes: []string{"10.0.0.0/8"}}},
+		"missing resolv backup":    {entry: Entry{Type: Resolv, Mode: ResolvRename, Backup: filepath.Join(dir, "missing")}},
+		"network manager":          {entry: Entry{Type: Resolv, Interface: "gof5-missing", Mode: ResolvManager}},
+		"unknown type":             {entry: Entry{Type: "unknown"}, fail: true},
+	} {
+		if err := undo(v.entry); (err != nil) != v.fail {
+			t.Errorf("unexpected %s undo result: %v", name, err)
+		}
+	}
+}
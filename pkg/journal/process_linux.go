@@ -0,0 +1,30 @@
+//go:build linux
+// +build linux
+
+package journal
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+)
+
+// processStart returns the process start time in clock ticks since boot
+func processStart(pid int) (string, bool) {
+	raw, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return "", false
+	}
+	// the process name may contain spaces and parentheses
+	i := bytes.LastIndexByte(raw, ')')
+	if i < 0 {
+		return "", true
+	}
+	// the fields start with the state, which is the 3rd field, the start
+	// time is the 22nd field
+	fields := bytes.Fields(raw[i+1:])
+	if len(fields) < 20 {
+		return "", true
+	}
+	return string(fields[19]), true
+}
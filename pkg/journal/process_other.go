@@ -0,0 +1,19 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package journal
+
+import (
+	"os"
+	"syscall"
+)
+
+// processStart reports whether the process is running, the start time is not
+// detected
+func processStart(pid int) (string, bool) {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return "", false
+	}
+	return "", p.Signal(syscall.Signal(0)) == nil
+}
@@ -0,0 +1,33 @@
+//go:build windows
+// +build windows
+
+package journal
+
+import (
+	"strconv"
+
+	"golang.org/x/sys/windows"
+)
+
+// the exit code of a running process
+const stillActive = 259
+
+// processStart returns the process creation time
+func processStart(pid int) (string, bool) {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return "", false
+	}
+	defer windows.CloseHandle(h)
+
+	var code uint32
+	if err = windows.GetExitCodeProcess(h, &code); err != nil || code != stillActive {
+		return "", false
+	}
+
+	var creation, exit, kernel, user windows.Filetime
+	if err = windows.GetProcessTimes(h, &creation, &exit, &kernel, &user); err != nil {
+		return "", true
+	}
+	return strconv.FormatInt(creation.Nanoseconds(), 10), true
+}
@@ -0,0 +1,113 @@
+package link
+
+import (
+	"io"
+	"net"
+
+	"github.com/kayrus/gof5/pkg/config"
+	"github.com/kayrus/gof5/pkg/policy"
+
+	"github.com/kayrus/tuncfg/resolv"
+	"github.com/kayrus/tuncfg/route"
+	"github.com/kayrus/tuncfg/tun"
+)
+
+// Device is a TUN interface, which reads and writes raw IP packets
+type Device interface {
+	io.ReadWriteCloser
+	Name() (string, error)
+}
+
+// MultiQueue is implemented by the devices with several packet queues, every
+// queue is read by its own goroutine
+type MultiQueue interface {
+	Queues() []io.Reader
+}
+
+// Router adds and removes routes via the VPN interface
+type Router interface {
+	Add()
+	Del()
+}
+
+// Resolver configures the system DNS settings
+type Resolver interface {
+	Set() error
+	Restore()
+	IsResolve() bool
+	IsNetworkManager() bool
+	IsShill() bool
+	GetOriginalDNS() []net.IP
+	GetOriginalSuffixes() []string
+	SetDNSServers([]net.IP)
+	SetSuffixes([]string)
+	SetDNSDomains([]string)
+}
+
+// Backend creates the TUN interface, the route and the DNS handlers
+type Backend struct {
+	OpenTun     func(local, gw *net.IPNet, name string, mtu int) (Device, error)
+	NewRouter   func(name string, routes []*net.IPNet, gw net.IP) (Router, error)
+	NewResolver func(name string, servers []net.IP, suffixes []string, rewrite bool) (Resolver, error)
+	// LocalNetworks returns the host networks, which are checked for the
+	// conflicts with the VPN routes, the check is skipped, when nil
+	LocalNetworks func(exclude string) ([]*net.IPNet, error)
+}
+
+// SystemBackend configures the operating system, it requires root privileges
+var SystemBackend = Backend{
+	OpenTun: func(local, gw *net.IPNet, name string, mtu int) (Device, error) {
+		tunDev, err := tun.OpenTunDevice(local, gw, name, mtu)
+		if err != nil {
+			return nil, err
+		}
+		return &tun.Tunnel{NativeTun: tunDev}, nil
+	},
+	NewRouter: func(name string, routes []*net.IPNet, gw net.IP) (Router, error) {
+		h, err := route.New(name, routes, gw, 0)
+		if err != nil {
+			return nil, err
+		}
+		return h, nil
+	},
+	NewResolver: func(name string, servers []net.IP, suffixes []string, rewrite bool) (Resolver, error) {
+		// this is used only in linux/freebsd to store /etc/resolv.conf backup
+		resolv.AppName = "gof5"
+		h, err := resolv.New(name, servers, suffixes, rewrite)
+		if err != nil {
+			return nil, err
+		}
+		return h, nil
+	},
+	LocalNetworks: localNetworks,
+}
+
+// NewSystemBackend returns the SystemBackend, which creates a multi-queue TUN
+// device with the optional TCP segmentation offload and installs routes with
+// the configured metric into the main or the dedicated table (Linux only)
+func NewSystemBackend(cfg *config.Config) Backend {
+	b := SystemBackend
+	if queues, offload := cfg.TunQueues, cfg.TunOffload; queues > 1 || offload {
+		b.OpenTun = func(local, gw *net.IPNet, name string, mtu int) (Device, error) {
+			return openMultiQueueTun(local, gw, name, mtu, queues, offload)
+		}
+	}
+	if table, metric := cfg.RouteTable, cfg.RouteMetric; table != 0 {
+		b.NewRouter = func(name string, routes []*net.IPNet, _ net.IP) (Router, error) {
+			h, err := policy.NewRouter(name, routes, table, metric)
+			if err != nil {
+				return nil, err
+			}
+			return h, nil
+		}
+	} else if metric > 0 {
+		b.NewRouter = func(name string, routes []*net.IPNet, gw net.IP) (Router, error) {
+			h, err := route.New(name, routes, gw, metric)
+			if err != nil {
+				return nil, err
+			}
+			return h, nil
+		}
+	}
+	return b
+}
@@ -4,7 +4,8 @@
 package link
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"os/exec"
 	"runtime"
 	"syscall"
@@ -15,30 +16,31 @@ import (
 func Cmd(cfg *config.Config) *exec.Cmd {
 	var cmd *exec.Cmd
 	if cfg.Driver == "pppd" {
-		// VPN
+		// don't modify the config args, the command is recreated on reconnect
+		args := append([]string{}, cfg.PPPdArgs...)
 		if cfg.IPv6 && bool(cfg.F5Config.Object.IPv6) {
-			cfg.PPPdArgs = append(cfg.PPPdArgs,
+			args = append(args,
 				"ipv6cp-accept-local",
 				"ipv6cp-accept-remote",
 				"+ipv6",
 			)
 		} else {
-			cfg.PPPdArgs = append(cfg.PPPdArgs,
+			args = append(args,
 				// TODO: clarify why it doesn't work
 				"noipv6", // Unsupported protocol 'IPv6 Control Protocol' (0x8057) received
 			)
 		}
-		if cfg.Debug {
-			cfg.PPPdArgs = append(cfg.PPPdArgs,
+		if pppLog.Enabled(context.Background(), slog.LevelDebug) {
+			args = append(args,
 				"debug",
 				"kdebug", "1",
 			)
-			log.Printf("pppd args: %q", cfg.PPPdArgs)
+			pppLog.Debug("pppd arguments", "args", args)
 		}
 
 		switch runtime.GOOS {
 		default:
-			cmd = exec.Command("pppd", cfg.PPPdArgs...)
+			cmd = exec.Command("pppd", args...)
 		case "freebsd":
 			cmd = exec.Command("ppp", "-direct")
 		}
@@ -6,8 +6,10 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
-	"log"
 	"net"
+	"time"
+
+	"github.com/kayrus/gof5/pkg/metrics"
 
 	"golang.org/x/net/ipv4"
 	"golang.org/x/net/ipv6"
@@ -46,8 +48,11 @@ var (
 	pfc         = []byte{0x07, 0x02}
 	acfc        = []byte{0x08, 0x02}
 	accm        = []byte{0x02, 0x06, 0x00, 0x00, 0x00, 0x00}
+	accmHeader  = []byte{0x02, 0x06}
+	accmSize    = 4
 	magicHeader = []byte{0x05, 0x06}
 	magicSize   = 4
+	ipv6IDSize  = 8 // IPv6CP interface identifier
 	ipv4header  = []byte{0x21}
 	ipv6header  = []byte{0x57}
 	//
@@ -56,6 +61,7 @@ var (
 	confNack    = []byte{0x03}
 	confRej     = []byte{0x04}
 	confTermReq = []byte{0x05}
+	codeReject  = []byte{0x07}
 	protoReject = []byte{0x08}
 	echoReq     = []byte{0x09}
 	echoRep     = []byte{0x0a}
@@ -69,52 +75,56 @@ func bytesToIPv6(bytes []byte) net.IP {
 	return net.IP(append([]byte{0xfe, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, append(bytes[:0:0], bytes...)...))
 }
 
-func processPPP(l *vpnLink, buf []byte, dstBuf *bytes.Buffer) error {
+func processPPP(l *vpnLink, buf []byte) error {
 	// process ipv4 traffic
 	if v := readBuf(buf, ipv4header); v != nil {
+		clampMSS(v, l.pathMTU())
+		l.Pcap.WritePacket(pcapIP, true, v)
 		if l.debug {
-			log.Printf("Read parsed ipv4 %d bytes from http:\n%s", len(v), hex.Dump(v))
 			header, _ := ipv4.ParseHeader(v)
-			log.Printf("ipv4 from http: %s", header)
+			pppLog.Debug("Read parsed ipv4 packet from http", "bytes", len(v), "header", header, "dump", hex.Dump(v))
 		}
 
 		wn, err := l.iface.Write(v)
 		if err != nil {
 			return fmt.Errorf("fatal write to tun: %s", err)
 		}
+		metrics.AddPacket(metrics.In, wn)
 		if l.debug {
-			log.Printf("Sent %d bytes to tun", wn)
+			pppLog.Debug("Sent packet to tun", "bytes", wn)
 		}
 		return nil
 	}
 
 	// process ipv6 traffic
 	if v := readBuf(buf, ipv6header); v != nil {
+		clampMSS(v, l.pathMTU())
+		l.Pcap.WritePacket(pcapIP, true, v)
 		if l.debug {
-			log.Printf("Read parsed ipv6 %d bytes from http:\n%s", len(v), hex.Dump(v))
 			header, _ := ipv6.ParseHeader(v)
-			log.Printf("ipv6 from http: %s", header)
+			pppLog.Debug("Read parsed ipv6 packet from http", "bytes", len(v), "header", header, "dump", hex.Dump(v))
 		}
 
 		wn, err := l.iface.Write(v)
 		if err != nil {
 			return fmt.Errorf("fatal write to tun: %s", err)
 		}
+		metrics.AddPacket(metrics.In, wn)
 		if l.debug {
-			log.Printf("Sent %d bytes to tun", wn)
+			pppLog.Debug("Sent packet to tun", "bytes", wn)
 		}
 		return nil
 	}
 
 	// TODO: support IPv4 only
 	if v := readBuf(buf, pppIPCP); v != nil {
-		if v := readBuf(v, confRequest); v != nil {
+		if v := readBuf(v, confRequest); len(v) > 0 {
 			id := v[0]
-			if v := readBuf(v[1:], ipv4type); v != nil {
+			if v := readBuf(v[1:], ipv4type); len(v) > 0 {
 				id2 := v[0]
-				if v := readBuf(v[1:], v4); v != nil {
+				if v := readBuf(v[1:], v4); len(v) == net.IPv4len {
 					l.serverIPv4 = bytesToIPv4(v)
-					log.Printf("id: %d, id2: %d, Remote IPv4 requested: %s", id, id2, l.serverIPv4)
+					pppLog.Info("Remote IPv4 requested", "id", id, "id2", id2, "ip", l.serverIPv4)
 
 					doResp := &bytes.Buffer{}
 					doResp.Write(ppp)
@@ -127,7 +137,7 @@ func processPPP(l *vpnLink, buf []byte, dstBuf *bytes.Buffer) error {
 					doResp.Write(v4)
 					doResp.Write(v)
 
-					err := toF5(l, doResp.Bytes(), dstBuf)
+					err := toF5(l, doResp.Bytes())
 					if err != nil {
 						return err
 					}
@@ -145,31 +155,35 @@ func processPPP(l *vpnLink, buf []byte, dstBuf *bytes.Buffer) error {
 						doResp.WriteByte(0)
 					}
 
-					return toF5(l, doResp.Bytes(), dstBuf)
+					return toF5(l, doResp.Bytes())
 				}
 			}
 		}
-		if v := readBuf(v, confAck); v != nil {
+		if v := readBuf(v, confAck); len(v) > 0 {
 			id := v[0]
-			if v := readBuf(v[1:], ipv4type); v != nil {
+			if v := readBuf(v[1:], ipv4type); len(v) > 0 {
 				id2 := v[0]
-				if v := readBuf(v[1:], v4); v != nil {
+				if v := readBuf(v[1:], v4); len(v) == net.IPv4len {
 					l.localIPv4 = bytesToIPv4(v)
-					log.Printf("id: %d, id2: %d, Local IPv4 acknowledged: %s", id, id2, l.localIPv4)
+					pppLog.Info("Local IPv4 acknowledged", "id", id, "id2", id2, "ip", l.localIPv4)
 
-					// connection established
-					close(l.pppUp)
+					// connection established, F5 may acknowledge the address twice
+					select {
+					case <-l.pppUp:
+					default:
+						close(l.pppUp)
+					}
 
 					return nil
 				}
 			}
 		}
-		if v := readBuf(v, confNack); v != nil {
+		if v := readBuf(v, confNack); len(v) > 0 {
 			id := v[0]
-			if v := readBuf(v[1:], ipv4type); v != nil {
+			if v := readBuf(v[1:], ipv4type); len(v) > 0 {
 				id2 := v[0]
-				if v := readBuf(v[1:], v4); v != nil {
-					log.Printf("id: %d, id2: %d, Local IPv4 not acknowledged: %s", id, id2, bytesToIPv4(v))
+				if v := readBuf(v[1:], v4); len(v) == net.IPv4len {
+					pppLog.Warn("Local IPv4 not acknowledged", "id", id, "id2", id2, "ip", bytesToIPv4(v))
 
 					doResp := &bytes.Buffer{}
 					doResp.Write(ppp)
@@ -182,7 +196,7 @@ func processPPP(l *vpnLink, buf []byte, dstBuf *bytes.Buffer) error {
 					doResp.Write(v4)
 					doResp.Write(v)
 
-					return toF5(l, doResp.Bytes(), dstBuf)
+					return toF5(l, doResp.Bytes())
 				}
 			}
 		}
@@ -190,13 +204,13 @@ func processPPP(l *vpnLink, buf []byte, dstBuf *bytes.Buffer) error {
 
 	// pppIPv6CP
 	if v := readBuf(buf, pppIPv6CP); v != nil {
-		if v := readBuf(v, confRequest); v != nil {
+		if v := readBuf(v, confRequest); len(v) > 0 {
 			id := v[0]
-			if v := readBuf(v[1:], ipv6type); v != nil {
+			if v := readBuf(v[1:], ipv6type); len(v) > 0 {
 				id2 := v[0]
-				if v := readBuf(v[1:], v6); v != nil {
+				if v := readBuf(v[1:], v6); len(v) == ipv6IDSize {
 					l.serverIPv6 = bytesToIPv6(v)
-					log.Printf("id: %d, id2: %d, Remote IPv6 requested: %s", id, id2, l.serverIPv6)
+					pppLog.Info("Remote IPv6 requested", "id", id, "id2", id2, "ip", l.serverIPv6)
 
 					doResp := &bytes.Buffer{}
 					doResp.Write(ppp)
@@ -209,7 +223,7 @@ func processPPP(l *vpnLink, buf []byte, dstBuf *bytes.Buffer) error {
 					doResp.Write(v6)
 					doResp.Write(v)
 
-					err := toF5(l, doResp.Bytes(), dstBuf)
+					err := toF5(l, doResp.Bytes())
 					if err != nil {
 						return err
 					}
@@ -227,28 +241,28 @@ func processPPP(l *vpnLink, buf []byte, dstBuf *bytes.Buffer) error {
 						doResp.WriteByte(0)
 					}
 
-					return toF5(l, doResp.Bytes(), dstBuf)
+					return toF5(l, doResp.Bytes())
 				}
 			}
 		}
-		if v := readBuf(v, confAck); v != nil {
+		if v := readBuf(v, confAck); len(v) > 0 {
 			id := v[0]
-			if v := readBuf(v[1:], ipv6type); v != nil {
+			if v := readBuf(v[1:], ipv6type); len(v) > 0 {
 				id2 := v[0]
-				if v := readBuf(v[1:], v6); v != nil {
+				if v := readBuf(v[1:], v6); len(v) == ipv6IDSize {
 					l.localIPv6 = bytesToIPv6(v)
-					log.Printf("id: %d, id2: %d, Local IPv6 acknowledged: %s", id, id2, l.localIPv6)
+					pppLog.Info("Local IPv6 acknowledged", "id", id, "id2", id2, "ip", l.localIPv6)
 
 					return nil
 				}
 			}
 		}
-		if v := readBuf(v, confNack); v != nil {
+		if v := readBuf(v, confNack); len(v) > 0 {
 			id := v[0]
-			if v := readBuf(v[1:], ipv6type); v != nil {
+			if v := readBuf(v[1:], ipv6type); len(v) > 0 {
 				id2 := v[0]
-				if v := readBuf(v[1:], v6); v != nil {
-					log.Printf("id: %d, id2: %d, Local IPv6 not acknowledged: %s", id, id2, bytesToIPv6(v))
+				if v := readBuf(v[1:], v6); len(v) == ipv6IDSize {
+					pppLog.Warn("Local IPv6 not acknowledged", "id", id, "id2", id2, "ip", bytesToIPv6(v))
 
 					doResp := &bytes.Buffer{}
 					doResp.Write(ppp)
@@ -261,7 +275,7 @@ func processPPP(l *vpnLink, buf []byte, dstBuf *bytes.Buffer) error {
 					doResp.Write(v6)
 					doResp.Write(v)
 
-					return toF5(l, doResp.Bytes(), dstBuf)
+					return toF5(l, doResp.Bytes())
 				}
 			}
 		}
@@ -271,7 +285,7 @@ func processPPP(l *vpnLink, buf []byte, dstBuf *bytes.Buffer) error {
 	if v := readBuf(buf, ppp); v != nil {
 		// it is pppLCP
 		if v := readBuf(v, pppLCP); v != nil {
-			if v := readBuf(v, confTermReq); v != nil {
+			if v := readBuf(v, confTermReq); len(v) > 0 {
 				id := v[0]
 				if v := readBuf(v[1:], terminate); v != nil {
 					return fmt.Errorf("id: %d, Link terminated with: %s", id, v)
@@ -283,11 +297,9 @@ func processPPP(l *vpnLink, buf []byte, dstBuf *bytes.Buffer) error {
 					return fmt.Errorf("id: %d, Link terminated with: %s", id, v)
 				}
 			}
-			if v := readBuf(v, echoReq); v != nil {
+			if v := readBuf(v, echoReq); len(v) > 0 {
 				id := v[0]
-				if l.debug {
-					log.Printf("id: %d, echo", id)
-				}
+				pppLog.Debug("LCP echo request", "id", id)
 				// live pings
 				doResp := &bytes.Buffer{}
 				doResp.Write(ppp)
@@ -297,33 +309,56 @@ func processPPP(l *vpnLink, buf []byte, dstBuf *bytes.Buffer) error {
 				doResp.WriteByte(id)
 				doResp.Write(v[1:])
 
-				return toF5(l, doResp.Bytes(), dstBuf)
+				return toF5(l, doResp.Bytes())
+			}
+			if v := readBuf(v, echoRep); len(v) > 0 {
+				id := v[0]
+				pppLog.Debug("LCP echo reply", "id", id)
+				if e := l.echo.Load(); e != nil && e.id == id {
+					metrics.SetLCPEchoRTT(time.Since(e.sent))
+				}
+				return nil
 			}
-			if v := readBuf(v, protoReject); v != nil {
+			if v := readBuf(v, codeReject); len(v) > 0 {
+				id := v[0]
+				// the rejected packet follows the id and the length
+				if len(v) > 3 && v[3] == echoReq[0] {
+					l.echoRejected.Store(true)
+				}
+				pppLog.Warn("Code reject", "id", id, "dump", hex.Dump(v))
+				return nil
+			}
+			if v := readBuf(v, protoReject); len(v) > 0 {
 				id := v[0]
 				if v := readBuf(v[1:], protoRej); v != nil {
-					log.Printf("id: %d, Protocol reject:\n%s", id, hex.Dump(v))
+					pppLog.Warn("Protocol reject", "id", id, "dump", hex.Dump(v))
 					return nil
 				}
 			}
 			// it is pppLCP
-			if v := readBuf(v, confRequest); v != nil {
+			if v := readBuf(v, confRequest); len(v) > 0 {
 				id := v[0]
 				// configuration requested
 				if v := readBuf(v[1:], mtuRequest); v != nil {
 					// MTU request
-					if v := readBuf(v, mtuHeader); v != nil {
+					if v := readBuf(v, mtuHeader); len(v) >= mtuSize {
 						// set MTU
 						t := v[:mtuSize]
 						l.mtu = append(t[:0:0], t...)
 						l.mtuInt = binary.BigEndian.Uint16(l.mtu)
-						log.Printf("MTU: %d", l.mtuInt)
-						if v := readBuf(v[mtuSize:], accm); v != nil {
-							if v := readBuf(v, magicHeader); v != nil {
+						pppLog.Info("MTU requested", "mtu", l.mtuInt)
+						if v := readBuf(v[mtuSize:], accmHeader); len(v) >= accmSize {
+							// the peer ACCM is used to escape the sent HDLC frames
+							peerACCM := binary.BigEndian.Uint32(v)
+							l.writer.setACCM(peerACCM)
+							if v := readBuf(v[accmSize:], magicHeader); len(v) >= magicSize+len(pfc)+len(acfc) {
 								magic := v[:magicSize]
-								log.Printf("Magic: %x", magic)
-								log.Printf("PFC: %x", v[magicSize:magicSize+len(pfc)])
-								log.Printf("ACFC: %x", v[magicSize+len(pfc):])
+								pppLog.Info("LCP options",
+									"accm", fmt.Sprintf("%08x", peerACCM),
+									"magic", hex.EncodeToString(magic),
+									"pfc", hex.EncodeToString(v[magicSize:magicSize+len(pfc)]),
+									"acfc", hex.EncodeToString(v[magicSize+len(pfc):]),
+								)
 
 								doResp := &bytes.Buffer{}
 								doResp.Write(ppp)
@@ -336,7 +371,7 @@ func processPPP(l *vpnLink, buf []byte, dstBuf *bytes.Buffer) error {
 								doResp.Write(pfc)
 								doResp.Write(acfc)
 
-								err := toF5(l, doResp.Bytes(), dstBuf)
+								err := toF5(l, doResp.Bytes())
 								if err != nil {
 									return err
 								}
@@ -352,7 +387,7 @@ func processPPP(l *vpnLink, buf []byte, dstBuf *bytes.Buffer) error {
 								doResp.Write(magicHeader)
 								doResp.Write(magic)
 
-								return toF5(l, doResp.Bytes(), dstBuf)
+								return toF5(l, doResp.Bytes())
 							}
 							return fmt.Errorf("wrong magic header: %x", v)
 						}
@@ -362,10 +397,12 @@ func processPPP(l *vpnLink, buf []byte, dstBuf *bytes.Buffer) error {
 				if v := readBuf(v[1:], mtuResponse); v != nil {
 					if v := readBuf(v, mtuHeader); v != nil {
 						if v := readBuf(v, l.mtu); v != nil {
-							if v := readBuf(v, accm); v != nil {
-								if v := readBuf(v, pfc); v != nil {
+							if v := readBuf(v, accmHeader); len(v) >= accmSize {
+								peerACCM := v[:accmSize]
+								l.writer.setACCM(binary.BigEndian.Uint32(peerACCM))
+								if v := readBuf(v[accmSize:], pfc); v != nil {
 									if v := readBuf(v, acfc); v != nil {
-										log.Printf("id: %d, MTU accepted", id)
+										pppLog.Info("MTU accepted", "id", id)
 
 										doResp := &bytes.Buffer{}
 										doResp.Write(ppp)
@@ -376,15 +413,12 @@ func processPPP(l *vpnLink, buf []byte, dstBuf *bytes.Buffer) error {
 										doResp.Write(mtuResponse)
 										doResp.Write(mtuHeader)
 										doResp.Write(l.mtu)
-										doResp.WriteByte(id)
-										doResp.Write(v4)
-										for i := 0; i < 4; i++ {
-											doResp.WriteByte(0)
-										}
+										doResp.Write(accmHeader)
+										doResp.Write(peerACCM)
 										doResp.Write(pfc)
 										doResp.Write(acfc)
 
-										return toF5(l, doResp.Bytes(), dstBuf)
+										return toF5(l, doResp.Bytes())
 									}
 								}
 							}
@@ -393,21 +427,21 @@ func processPPP(l *vpnLink, buf []byte, dstBuf *bytes.Buffer) error {
 				}
 			}
 			// do set
-			if v := readBuf(v, confAck); v != nil {
+			if v := readBuf(v, confAck); len(v) > 0 {
 				// required settings
 				id := v[0]
 				if v := readBuf(v[1:], ipv6type); v != nil {
 					if v := readBuf(v, accm); v != nil {
 						if v := readBuf(v, pfc); v != nil {
 							if v := readBuf(v, acfc); v != nil {
-								log.Printf("id: %d, IPV6 accepted", id)
+								pppLog.Info("IPV6 accepted", "id", id)
 								return nil
 							}
 						}
 					}
 				}
 			}
-			if v := readBuf(v, confNack); v != nil {
+			if v := readBuf(v, confNack); len(v) > 0 {
 				id := v[0]
 				if v := readBuf(v[1:], mtuRequest); v != nil {
 					if v := readBuf(v, mtuHeader); v != nil {
@@ -428,108 +462,111 @@ func processPPP(l *vpnLink, buf []byte, dstBuf *bytes.Buffer) error {
 	return fmt.Errorf("unknown PPP data:\n%s", hex.Dump(buf))
 }
 
-func fromF5(l *vpnLink, dstBuf *bytes.Buffer) error {
+// detectFraming switches between the F5 and the HDLC framing, since the server
+// may ignore the requested one
+func (l *vpnLink) detectFraming() error {
+	b, err := l.reader.Peek(1)
+	if err != nil {
+		return fmt.Errorf("failed to read F5 packet header: %s", err)
+	}
+	l.framingChecked = true
+
+	if hdlc := b[0] == hdlcFlag; hdlc != l.hdlc {
+		pppLog.Info("Server uses another framing than requested", "hdlc", hdlc)
+		l.hdlc = hdlc
+		l.writer.setHDLC(hdlc)
+	}
+	if l.hdlc && l.hdlcBuf == nil {
+		l.hdlcBuf = make([]byte, l.maxFrameSize()+2)
+	}
+
+	return nil
+}
+
+func fromF5(l *vpnLink) error {
+	if !l.framingChecked {
+		if err := l.detectFraming(); err != nil {
+			return err
+		}
+	}
+
+	if l.hdlc {
+		buf, err := readHDLC(l.reader, l.hdlcBuf)
+		if err != nil {
+			return err
+		}
+		l.Pcap.WritePacket(pcapPPP, true, buf)
+		return processPPP(l, compressPPP(buf))
+	}
+
 	// read the F5 packet header
-	buf := make([]byte, 2)
-	_, err := io.ReadFull(l.HTTPConn, buf)
+	buf, err := l.reader.Peek(4)
 	if err != nil {
 		return fmt.Errorf("failed to read F5 packet header: %s", err)
 	}
 	if !(buf[0] == 0xf5 && buf[1] == 00) {
-		return fmt.Errorf("incorrect F5 header: %x", buf)
+		return fmt.Errorf("incorrect F5 header: %x", buf[:2])
 	}
 
 	// read the F5 packet size
-	var pkglen uint16
-	err = binary.Read(l.HTTPConn, binary.BigEndian, &pkglen)
-	if err != nil {
-		return fmt.Errorf("failed to read F5 packet size: %s", err)
+	pkglen := int(binary.BigEndian.Uint16(buf[2:]))
+	if pkglen == 0 || pkglen > l.maxFrameSize() {
+		return fmt.Errorf("incorrect F5 packet size: %d", pkglen)
 	}
 
-	// read the packet
-	buf = make([]byte, pkglen)
-	n, err := io.ReadFull(l.HTTPConn, buf)
+	// read the packet, the buffered data stays valid until the next read
+	buf, err = l.reader.Peek(4 + pkglen)
 	if err != nil {
 		return fmt.Errorf("failed to read F5 packet of the %d size: %s", pkglen, err)
 	}
-	if n != int(pkglen) {
-		return fmt.Errorf("incorrect F5 packet size: %d, expected: %d", n, pkglen)
-	}
+	buf = buf[4:]
+	l.reader.Discard(4 + pkglen)
+
+	l.Pcap.WritePacket(pcapPPP, true, buf)
 
 	// process the packet
-	return processPPP(l, buf, dstBuf)
+	return processPPP(l, buf)
 }
 
 // Decode F5 packet
 // http->tun
 func (l *vpnLink) HttpToTun() {
-	dstBuf := &bytes.Buffer{}
 	for {
 		select {
 		case <-l.TunDown:
 			return
 		default:
-			err := fromF5(l, dstBuf)
+			err := fromF5(l)
 			if err != nil {
-				l.ErrChan <- err
+				l.sendErr(err)
 				return
 			}
 		}
 	}
 }
 
-func toF5(l *vpnLink, buf []byte, dst *bytes.Buffer) error {
-	// TODO: move buffer initialization into tunToHTTP
-	// probably a buffered pipe would be nicer
-	length := len(buf)
-	if length == 0 {
+func toF5(l *vpnLink, buf []byte) error {
+	if len(buf) == 0 {
 		return fmt.Errorf("cannot encapsulate zero packet")
 	}
 
-	defer dst.Reset()
-
 	// TODO: check packet header length (ipv4.HeaderLen, ipv6.HeaderLen)
+	var proto []byte
 	switch buf[0] >> 4 {
 	case ipv4.Version:
-		length += len(ipv4header)
-	case ipv6.Version:
-		length += len(ipv6header)
-	}
-
-	_, err := dst.Write([]byte{0xf5, 0x00})
-	if err != nil {
-		return fmt.Errorf("failed to write F5 header: %s", err)
-	}
-	err = binary.Write(dst, binary.BigEndian, uint16(length))
-	if err != nil {
-		return fmt.Errorf("failed to write F5 header size: %s", err)
-	}
-
-	switch buf[0] >> 4 {
-	case ipv4.Version:
-		_, err = dst.Write(ipv4header)
+		proto = ipv4header
 	case ipv6.Version:
-		_, err = dst.Write(ipv6header)
-	}
-	if err != nil {
-		return fmt.Errorf("failed to write IP header: %s", err)
+		proto = ipv6header
 	}
 
 	if l.debug {
-		log.Printf("Sending from pppd:\n%s", hex.Dump(buf))
+		pppLog.Debug("Sending packet to http", "bytes", len(buf), "dump", hex.Dump(buf))
 	}
 
-	_, err = dst.Write(buf)
-	if err != nil {
-		return fmt.Errorf("fatal write to http: %s", err)
-	}
-	wn, err := io.Copy(l.HTTPConn, dst)
+	err := l.writer.writeFrame(l.Pcap, proto, buf)
 	if err != nil {
 		return fmt.Errorf("fatal write to http: %s", err)
 	}
-	if l.debug {
-		log.Printf("Sent %d bytes to http", wn)
-	}
 
 	return nil
 }
@@ -537,29 +574,123 @@ func toF5(l *vpnLink, buf []byte, dst *bytes.Buffer) error {
 // Encode into F5 packet
 // tun->http
 func (l *vpnLink) TunToHTTP() {
-	buf := make([]byte, bufferSize)
-	dstBuf := &bytes.Buffer{}
+	select {
+	case <-l.TunDown:
+		return
+	case <-l.tunUp:
+	}
+
+	// every queue of a multi-queue device is read concurrently
+	if mq, ok := l.iface.(MultiQueue); ok {
+		queues := mq.Queues()
+		for _, q := range queues[1:] {
+			go l.queueToHTTP(q)
+		}
+		l.queueToHTTP(queues[0])
+		return
+	}
+
+	l.queueToHTTP(l.iface)
+}
+
+func (l *vpnLink) queueToHTTP(queue io.Reader) {
+	buf := make([]byte, l.bufferSize)
+	icmp := make([]byte, ipv6MinMTU)
+	mtu := l.pathMTU()
 	for {
 		select {
 		case <-l.TunDown:
 			return
-		case <-l.tunUp:
-			rn, err := l.iface.Read(buf)
+		default:
+			rn, err := queue.Read(buf)
 			if err != nil {
 				if err != io.EOF {
-					l.ErrChan <- fmt.Errorf("fatal read tun: %s", err)
+					l.sendErr(fmt.Errorf("fatal read tun: %s", err))
 				}
 				return
 			}
 			if l.debug {
-				log.Printf("Read %d bytes from tun:\n%s", rn, hex.Dump(buf[:rn]))
 				header, _ := ipv4.ParseHeader(buf[:rn])
-				log.Printf("ipv4 from tun: %s", header)
+				pppLog.Debug("Read packet from tun", "bytes", rn, "header", header, "dump", hex.Dump(buf[:rn]))
 			}
 
-			err = toF5(l, buf[:rn], dstBuf)
+			// reject packets, which don't fit the negotiated MTU, the
+			// packets, which cannot be answered with ICMP, are dropped
+			if mtu > 0 && rn > mtu {
+				pppLog.Debug("Packet exceeds the MTU", "bytes", rn, "mtu", mtu)
+				if reply := packetTooBig(buf[:rn], mtu, icmp); reply != nil {
+					if _, err = l.iface.Write(reply); err != nil {
+						l.sendErr(fmt.Errorf("fatal write to tun: %s", err))
+						return
+					}
+				}
+				continue
+			}
+			clampMSS(buf[:rn], mtu)
+
+			l.Pcap.WritePacket(pcapIP, false, buf[:rn])
+
+			err = toF5(l, buf[:rn])
 			if err != nil {
-				l.ErrChan <- err
+				l.sendErr(err)
+				return
+			}
+			metrics.AddPacket(metrics.Out, rn)
+		}
+	}
+}
+
+// sendErr reports the error, unless the tunnel is already down, only the first
+// error is consumed, thus the other goroutines must not block on ErrChan
+func (l *vpnLink) sendErr(err error) {
+	select {
+	case l.ErrChan <- err:
+	case <-l.TunDown:
+	}
+}
+
+type lcpEcho struct {
+	id   byte
+	sent time.Time
+}
+
+// LCPEcho periodically sends LCP echo requests to measure the tunnel RTT
+func (l *vpnLink) LCPEcho() {
+	// wait for ppp handshake completed
+	select {
+	case <-l.pppUp:
+	case <-l.TunDown:
+		return
+	}
+
+	ticker := time.NewTicker(lcpEchoInterval)
+	defer ticker.Stop()
+
+	var id byte
+	for {
+		select {
+		case <-l.TunDown:
+			return
+		case <-ticker.C:
+			if l.echoRejected.Load() {
+				pppLog.Warn("LCP echo requests are rejected by the server, RTT is not measured")
+				return
+			}
+			id++
+			req := &bytes.Buffer{}
+			req.Write(ppp)
+			req.Write(pppLCP)
+			//
+			req.Write(echoReq)
+			req.WriteByte(id)
+			// code, id, length and magic number
+			req.Write([]byte{0x00, 0x08})
+			// magic number is rejected during the LCP negotiation
+			req.Write(make([]byte, magicSize))
+
+			l.echo.Store(&lcpEcho{id: id, sent: time.Now()})
+			if err := toF5(l, req.Bytes()); err != nil {
+				l.sendErr(err)
 				return
 			}
 		}
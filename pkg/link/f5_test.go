@@ -0,0 +1,164 @@
+package link
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+)
+
+// f5Conn reads the scripted F5 frames and discards the client frames
+type f5Conn struct {
+	io.Reader
+}
+
+func (f5Conn) Write(b []byte) (int, error) { return len(b), nil }
+func (f5Conn) Close() error                { return nil }
+
+// discardDevice is a TUN device, which discards the packets
+type discardDevice struct{}
+
+func (discardDevice) Read([]byte) (int, error)    { return 0, io.EOF }
+func (discardDevice) Write(b []byte) (int, error) { return len(b), nil }
+func (discardDevice) Close() error                { return nil }
+func (discardDevice) Name() (string, error)       { return "tun0", nil }
+
+// f5Frames encodes hex PPP frames into the F5 framing
+func f5Frames(t testing.TB, frames ...string) []byte {
+	buf := &bytes.Buffer{}
+	for _, v := range frames {
+		b, err := hex.DecodeString(strings.ReplaceAll(v, " ", ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write([]byte{0xf5, 0x00, byte(len(b) >> 8), byte(len(b))})
+		buf.Write(b)
+	}
+	return buf.Bytes()
+}
+
+// the PPP negotiation frames, sent by F5
+var negotiation = []string{
+	// LCP Configure-Request: MRU, ACCM, magic number, PFC, ACFC
+	"ff03 c021 01 01 0018 0104 0534 020600000000 0506 deadbeef 0702 0802",
+	// LCP Configure-Ack
+	"ff03 c021 02 01 000e 020600000000 0702 0802",
+	// LCP Configure-Request without the magic number
+	"ff03 c021 01 02 0012 0104 0534 020600000000 0702 0802",
+	// IPCP Configure-Request: server IP address
+	"8021 01 03 000a 0306 ac100001",
+	// IPCP Configure-Nak: client IP address
+	"8021 03 03 000a 0306 ac100002",
+	// IPCP Configure-Ack
+	"8021 02 03 000a 0306 ac100002",
+	// IPCP Configure-Ack duplicate
+	"8021 02 03 000a 0306 ac100002",
+	// IPv6CP Configure-Request: server interface identifier
+	"8057 01 04 000e 010a 0000000000000001",
+	// LCP Echo-Request
+	"ff03 c021 09 05 0008 00000000",
+	// LCP Echo-Reply
+	"ff03 c021 0a 01 0008 00000000",
+	// LCP Code-Reject of the Echo-Request
+	"ff03 c021 07 06 000c 09 02 0008 00000000",
+	// IPv4 packet
+	"21 4500001c0000000040110000ac1000020a000001 0035003500080000",
+}
+
+func newFuzzLink(data []byte) *vpnLink {
+	conn := f5Conn{bytes.NewReader(data)}
+	return &vpnLink{
+		HTTPConn:   conn,
+		reader:     bufio.NewReaderSize(conn, readBufferSize),
+		writer:     newFrameWriter(conn, coalesceSize, defaultBufferSize+4),
+		iface:      discardDevice{},
+		pppUp:      make(chan struct{}),
+		bufferSize: defaultBufferSize,
+	}
+}
+
+func TestFromF5(t *testing.T) {
+	l := newFuzzLink(f5Frames(t, negotiation...))
+	for range negotiation {
+		if err := fromF5(l); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if l.mtuInt != 1332 {
+		t.Errorf("MTU is %d, expected 1332", l.mtuInt)
+	}
+	if v := l.localIPv4.String(); v != "172.16.0.2" {
+		t.Errorf("local IP is %s, expected 172.16.0.2", v)
+	}
+	select {
+	case <-l.pppUp:
+	default:
+		t.Error("PPP negotiation is not completed")
+	}
+	if !l.echoRejected.Load() {
+		t.Error("LCP echo reject is not detected")
+	}
+}
+
+func TestFromF5Malformed(t *testing.T) {
+	for _, v := range []string{
+		// truncated frames
+		"ff03 c021 01",
+		"ff03 c021 05",
+		"ff03 c021 09",
+		"ff03 c021 08",
+		"ff03 c021 01 01 0018 0104 05",
+		"ff03 c021 01 01 0018 0104 0534 020600000000 0506 dead",
+		"8021 01",
+		"8021 01 03 000a",
+		"8021 01 03 000a 0306 ac10",
+		"8021 02 03 000a 0306 ac100002ac",
+		"8057 01 04 000e 010a 00000000",
+		"",
+	} {
+		l := newFuzzLink(f5Frames(t, v))
+		if err := fromF5(l); err == nil {
+			t.Errorf("%q: expected an error", v)
+		}
+	}
+
+	// oversized frame
+	l := newFuzzLink([]byte{0xf5, 0x00, 0xff, 0xff})
+	if err := fromF5(l); err == nil {
+		t.Error("expected an oversized frame error")
+	}
+}
+
+// the fuzz targets are also seeded by the testdata/fuzz corpus, which holds
+// the frames of a typical session: negotiation, keepalives, termination
+// and the IP packets, all addresses are replaced with the private ones
+func FuzzFromF5(f *testing.F) {
+	for _, v := range negotiation {
+		f.Add(f5Frames(f, v))
+	}
+	f.Add(f5Frames(f, negotiation...))
+	f.Add(hdlcFrames(f, negotiation...))
+	f.Add(f5Frames(f, "ff03 c021 05 06 0017 41646d696e69737472617469766520 73746f70"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		l := newFuzzLink(data)
+		for fromF5(l) == nil {
+		}
+	})
+}
+
+func FuzzProcessPPP(f *testing.F) {
+	for _, v := range negotiation {
+		b, err := hex.DecodeString(strings.ReplaceAll(v, " ", ""))
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		processPPP(newFuzzLink(nil), data)
+	})
+}
@@ -0,0 +1,186 @@
+package link
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/kayrus/gof5/pkg/pcap"
+)
+
+// framePool holds the F5 frame batches, a batch grows only with the buffer
+// size above the default, since it is flushed once it exceeds the coalesceSize
+var framePool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, coalesceSize+defaultBufferSize+8)
+		return &b
+	},
+}
+
+// frameWriter encodes packets into F5 or HDLC frames. Frames queued while the
+// connection is busy are coalesced into a single write.
+type frameWriter struct {
+	w io.Writer
+	// a batch exceeding the limit is flushed synchronously, zero disables
+	// coalescing, i.e. every frame is written immediately
+	limit int
+	// the biggest frame payload
+	maxFrame int
+	debug    bool
+	// HDLC framing is used instead of the F5 framing
+	hdlc bool
+	// the ACCM, requested by the peer, the HDLC frames are escaped with
+	accm uint32
+	// unframed PPP frame, used for the HDLC frames capture
+	scratch []byte
+	// mu protects the framing parameters and the pending batch
+	mu  sync.Mutex
+	buf *[]byte
+	// wmu serializes the connection writes
+	wmu sync.Mutex
+	// ready wakes up the flusher
+	ready chan struct{}
+}
+
+func newFrameWriter(w io.Writer, limit, maxFrame int) *frameWriter {
+	return &frameWriter{
+		w:        w,
+		limit:    limit,
+		maxFrame: maxFrame,
+		debug:    pppLog.Enabled(context.Background(), slog.LevelDebug),
+		buf:      framePool.Get().(*[]byte),
+		ready:    make(chan struct{}, 1),
+	}
+}
+
+// setHDLC switches the HDLC framing
+func (f *frameWriter) setHDLC(hdlc bool) {
+	f.mu.Lock()
+	f.hdlc = hdlc
+	f.mu.Unlock()
+}
+
+// setACCM sets the ACCM, negotiated by the peer
+func (f *frameWriter) setACCM(accm uint32) {
+	f.mu.Lock()
+	f.accm = accm
+	f.mu.Unlock()
+}
+
+// writeFrame queues an F5 frame with the PPP protocol prefix and the payload
+func (f *frameWriter) writeFrame(capture *pcap.Writer, proto, payload []byte) error {
+	length := len(proto) + len(payload)
+	if length > f.maxFrame {
+		return fmt.Errorf("cannot encapsulate %d bytes into the F5 frame", length)
+	}
+
+	if f.limit == 0 {
+		return f.writeDirect(capture, proto, payload)
+	}
+
+	f.mu.Lock()
+	*f.buf = f.appendFrame(*f.buf, capture, proto, payload)
+	n := len(*f.buf)
+	f.mu.Unlock()
+
+	if n > f.limit {
+		return f.flush()
+	}
+
+	select {
+	case f.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// appendFrame appends the encoded frame to the buffer, f.mu must be held
+func (f *frameWriter) appendFrame(b []byte, capture *pcap.Writer, proto, payload []byte) []byte {
+	if f.hdlc {
+		b = appendHDLC(b, proto, payload, f.accm)
+		if capture != nil {
+			f.scratch = append(append(f.scratch[:0], proto...), payload...)
+			capture.WritePacket(pcapPPP, false, f.scratch)
+		}
+		return b
+	}
+
+	b = append(b, 0xf5, 0x00, 0x00, 0x00)
+	start := len(b)
+	binary.BigEndian.PutUint16(b[start-2:], uint16(len(proto)+len(payload)))
+	b = append(b, proto...)
+	b = append(b, payload...)
+	// skip the F5 header
+	capture.WritePacket(pcapPPP, false, b[start:])
+	return b
+}
+
+// writeDirect writes a single frame into the connection bypassing the batch,
+// e.g. every DTLS write is a separate datagram, which must contain only one
+// frame
+func (f *frameWriter) writeDirect(capture *pcap.Writer, proto, payload []byte) error {
+	f.wmu.Lock()
+	defer f.wmu.Unlock()
+
+	buf := framePool.Get().(*[]byte)
+	f.mu.Lock()
+	*buf = f.appendFrame((*buf)[:0], capture, proto, payload)
+	f.mu.Unlock()
+
+	wn, err := f.w.Write(*buf)
+	*buf = (*buf)[:0]
+	framePool.Put(buf)
+	if err != nil {
+		return err
+	}
+	if f.debug {
+		pppLog.Debug("Sent frames to http", "bytes", wn)
+	}
+
+	return nil
+}
+
+// flush writes the pending frames into the connection
+func (f *frameWriter) flush() error {
+	f.wmu.Lock()
+	defer f.wmu.Unlock()
+
+	f.mu.Lock()
+	buf := f.buf
+	if len(*buf) == 0 {
+		f.mu.Unlock()
+		return nil
+	}
+	f.buf = framePool.Get().(*[]byte)
+	f.mu.Unlock()
+
+	wn, err := f.w.Write(*buf)
+	*buf = (*buf)[:0]
+	framePool.Put(buf)
+	if err != nil {
+		return err
+	}
+	if f.debug {
+		pppLog.Debug("Sent frames to http", "bytes", wn)
+	}
+
+	return nil
+}
+
+// FlushToHTTP writes the coalesced F5 frames into the connection
+func (l *vpnLink) FlushToHTTP() {
+	for {
+		select {
+		case <-l.TunDown:
+			return
+		case <-l.writer.ready:
+			if err := l.writer.flush(); err != nil {
+				l.sendErr(fmt.Errorf("fatal write to http: %s", err))
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package link
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// countWriter counts the connection writes
+type countWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *countWriter) Write(b []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(b)
+}
+
+func TestFrameWriter(t *testing.T) {
+	pkt := f5Frames(t, negotiation[len(negotiation)-1])[5:]
+
+	w := &countWriter{}
+	f := newFrameWriter(w, coalesceSize, defaultBufferSize+4)
+	for i := 0; i < 3; i++ {
+		if err := f.writeFrame(nil, ipv4header, pkt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if w.writes != 1 {
+		t.Errorf("frames were written %d times, expected a single write", w.writes)
+	}
+
+	l := newFuzzLink(w.Bytes())
+	for i := 0; i < 3; i++ {
+		if err := fromF5(l); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// coalescing is disabled
+	w = &countWriter{}
+	f = newFrameWriter(w, 0, defaultBufferSize+4)
+	for i := 0; i < 3; i++ {
+		if err := f.writeFrame(nil, ipv4header, pkt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if w.writes != 3 {
+		t.Errorf("frames were written %d times, expected 3 writes", w.writes)
+	}
+
+	if err := f.writeFrame(nil, ipv4header, make([]byte, defaultBufferSize+4)); err == nil {
+		t.Error("expected an oversized frame error")
+	}
+}
+
+// datagramWriter records the write sizes
+type datagramWriter struct {
+	sizes []int
+}
+
+func (w *datagramWriter) Write(b []byte) (int, error) {
+	w.sizes = append(w.sizes, len(b))
+	return len(b), nil
+}
+
+func TestFrameWriterDatagrams(t *testing.T) {
+	pkt := f5Frames(t, negotiation[len(negotiation)-1])[5:]
+	frameSize := 4 + len(ipv4header) + len(pkt)
+
+	w := &datagramWriter{}
+	l := &vpnLink{
+		ErrChan: make(chan error, 1),
+		TunDown: make(chan struct{}),
+		writer:  newFrameWriter(w, 0, defaultBufferSize+4),
+	}
+	go l.FlushToHTTP()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if err := l.writer.writeFrame(nil, ipv4header, pkt); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(l.TunDown)
+
+	l.writer.wmu.Lock()
+	defer l.writer.wmu.Unlock()
+	if len(w.sizes) != 800 {
+		t.Errorf("frames were written %d times, expected 800 writes", len(w.sizes))
+	}
+	for _, v := range w.sizes {
+		if v != frameSize {
+			t.Fatalf("datagram contains %d bytes, expected a single %d bytes frame", v, frameSize)
+		}
+	}
+}
+
+// loopReader endlessly repeats the data
+type loopReader struct {
+	data []byte
+	off  int
+}
+
+func (r *loopReader) Read(b []byte) (int, error) {
+	n := 0
+	for n < len(b) {
+		c := copy(b[n:], r.data[r.off:])
+		r.off = (r.off + c) % len(r.data)
+		n += c
+	}
+	return n, nil
+}
+
+func BenchmarkFromF5(b *testing.B) {
+	pkt := make([]byte, 1400)
+	pkt[0] = 0x45
+	frame := f5Frames(b, "21"+hex.EncodeToString(pkt))
+
+	conn := f5Conn{&loopReader{data: frame}}
+	l := &vpnLink{
+		HTTPConn:   conn,
+		reader:     bufio.NewReaderSize(conn, readBufferSize),
+		iface:      discardDevice{},
+		bufferSize: defaultBufferSize,
+	}
+
+	b.SetBytes(int64(len(pkt)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := fromF5(l); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// loopbackTLS returns a client TLS connection to a loopback server, which
+// discards the received data
+func loopbackTLS(b *testing.B) net.Conn {
+	srv := httptest.NewTLSServer(nil)
+	cert := srv.TLS.Certificates
+	srv.Close()
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: cert})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { ln.Close() })
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		io.Copy(io.Discard, c)
+	}()
+
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func BenchmarkToF5(b *testing.B) {
+	pkt := make([]byte, 1400)
+	pkt[0] = 0x45
+
+	for _, v := range []struct {
+		name  string
+		limit int
+	}{
+		{"unbuffered", 0},
+		{"coalesced", coalesceSize},
+	} {
+		b.Run(v.name, func(b *testing.B) {
+			conn := loopbackTLS(b)
+			l := &vpnLink{
+				HTTPConn: conn,
+				ErrChan:  make(chan error, 1),
+				TunDown:  make(chan struct{}),
+				writer:   newFrameWriter(conn, v.limit, defaultBufferSize+4),
+			}
+			go l.FlushToHTTP()
+			defer close(l.TunDown)
+
+			b.SetBytes(int64(len(pkt)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := toF5(l, pkt); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if err := l.writer.flush(); err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+//go:build linux
+// +build linux
+
+package link
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// struct virtio_net_hdr size
+	virtioNetHdrLen = 10
+	// the biggest GSO packet, returned by the kernel
+	maxGSOSize = 0xffff
+	tcpFlagFIN = 0x01
+	tcpFlagPSH = 0x08
+	tcpFlagCWR = 0x80
+)
+
+// virtioNetHdr is the header, which precedes every packet, when the TUN
+// device is created with the IFF_VNET_HDR flag
+type virtioNetHdr struct {
+	flags      uint8
+	gsoType    uint8
+	hdrLen     uint16
+	gsoSize    uint16
+	csumStart  uint16
+	csumOffset uint16
+}
+
+func (h *virtioNetHdr) decode(b []byte) {
+	h.flags = b[0]
+	h.gsoType = b[1]
+	h.hdrLen = binary.NativeEndian.Uint16(b[2:])
+	h.gsoSize = binary.NativeEndian.Uint16(b[4:])
+	h.csumStart = binary.NativeEndian.Uint16(b[6:])
+	h.csumOffset = binary.NativeEndian.Uint16(b[8:])
+}
+
+// gsoReader splits the GSO packets, read from a TUN device queue with the
+// virtio-net header, into MTU sized TCP segments, so the encoder receives a
+// batch of ready to send packets per a single read syscall
+type gsoReader struct {
+	r   io.Reader
+	buf []byte
+	hdr virtioNetHdr
+	// the pending GSO packet, its TCP/IP headers length, the next segment
+	// payload offset and the segment number
+	pkt    []byte
+	hdrLen int
+	off    int
+	seg    int
+}
+
+func newGSOReader(r io.Reader) *gsoReader {
+	return &gsoReader{
+		r:   r,
+		buf: make([]byte, virtioNetHdrLen+maxGSOSize),
+	}
+}
+
+// Read returns a single IP packet
+func (g *gsoReader) Read(b []byte) (int, error) {
+	if g.pkt != nil {
+		return g.nextSegment(b)
+	}
+
+	n, err := g.r.Read(g.buf)
+	if err != nil {
+		return 0, err
+	}
+	if n < virtioNetHdrLen {
+		return 0, fmt.Errorf("short virtio-net header: %d bytes", n)
+	}
+	g.hdr.decode(g.buf)
+	// ECN marked TCP packets, the CWR flag is kept only in the first segment
+	g.hdr.gsoType &^= unix.VIRTIO_NET_HDR_GSO_ECN
+	pkt := g.buf[virtioNetHdrLen:n]
+
+	switch g.hdr.gsoType {
+	case unix.VIRTIO_NET_HDR_GSO_NONE:
+		if g.hdr.flags&unix.VIRTIO_NET_HDR_F_NEEDS_CSUM != 0 {
+			// the checksum field contains the pseudo header sum
+			start, off := int(g.hdr.csumStart), int(g.hdr.csumOffset)
+			if start+off+2 > len(pkt) {
+				return 0, fmt.Errorf("invalid checksum offset: %d+%d", start, off)
+			}
+			binary.BigEndian.PutUint16(pkt[start+off:], foldChecksum(checksum(pkt[start:], 0)))
+		}
+		if len(pkt) > len(b) {
+			return 0, io.ErrShortBuffer
+		}
+		return copy(b, pkt), nil
+	case unix.VIRTIO_NET_HDR_GSO_TCPV4, unix.VIRTIO_NET_HDR_GSO_TCPV6:
+		start := int(g.hdr.csumStart)
+		minStart := ipv4.HeaderLen
+		if g.hdr.gsoType == unix.VIRTIO_NET_HDR_GSO_TCPV6 {
+			minStart = ipv6.HeaderLen
+		}
+		if g.hdr.gsoSize == 0 || start < minStart || start+20 > len(pkt) {
+			return 0, fmt.Errorf("invalid GSO packet: csum start %d, size %d", start, len(pkt))
+		}
+		g.hdrLen = start + int(pkt[start+12]>>4)*4
+		if g.hdrLen > len(pkt) {
+			return 0, fmt.Errorf("invalid GSO packet: header length %d, size %d", g.hdrLen, len(pkt))
+		}
+		g.pkt = pkt
+		g.off = g.hdrLen
+		g.seg = 0
+		return g.nextSegment(b)
+	}
+
+	return 0, fmt.Errorf("unsupported GSO type: %d", g.hdr.gsoType)
+}
+
+// nextSegment copies the TCP/IP headers and the next payload chunk of the
+// pending GSO packet and fixes the headers
+func (g *gsoReader) nextSegment(b []byte) (int, error) {
+	end := g.off + int(g.hdr.gsoSize)
+	if end > len(g.pkt) {
+		end = len(g.pkt)
+	}
+	n := g.hdrLen + end - g.off
+	if n > len(b) {
+		g.pkt = nil
+		return 0, io.ErrShortBuffer
+	}
+	copy(b, g.pkt[:g.hdrLen])
+	copy(b[g.hdrLen:], g.pkt[g.off:end])
+
+	start := int(g.hdr.csumStart)
+	ip, tcp := b[:start], b[start:n]
+
+	// IP header
+	var sum uint32
+	switch ip[0] >> 4 {
+	case ipv4.Version:
+		binary.BigEndian.PutUint16(ip[2:], uint16(n))
+		binary.BigEndian.PutUint16(ip[4:], binary.BigEndian.Uint16(ip[4:])+uint16(g.seg))
+		ip[10], ip[11] = 0, 0
+		binary.BigEndian.PutUint16(ip[10:], foldChecksum(checksum(ip[:int(ip[0]&0x0f)*4], 0)))
+		sum = checksum(ip[12:20], 0)
+	case ipv6.Version:
+		binary.BigEndian.PutUint16(ip[4:], uint16(n-ipv6.HeaderLen))
+		sum = checksum(ip[8:40], 0)
+	}
+
+	// TCP header
+	seq := binary.BigEndian.Uint32(tcp[4:]) + uint32(g.off-g.hdrLen)
+	binary.BigEndian.PutUint32(tcp[4:], seq)
+	if g.seg > 0 {
+		tcp[13] &^= tcpFlagCWR
+	}
+	last := end == len(g.pkt)
+	if !last {
+		tcp[13] &^= tcpFlagFIN | tcpFlagPSH
+	}
+	tcp[16], tcp[17] = 0, 0
+	sum += uint32(unix.IPPROTO_TCP) + uint32(len(tcp))
+	binary.BigEndian.PutUint16(tcp[16:], foldChecksum(checksum(tcp, sum)))
+
+	g.off = end
+	g.seg++
+	if last {
+		g.pkt = nil
+	}
+
+	return n, nil
+}
@@ -0,0 +1,131 @@
+//go:build linux
+// +build linux
+
+package link
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// gsoPacket returns a TCP GSO packet with the virtio-net header
+func gsoPacket(v6 bool, payload, mss int) []byte {
+	ipLen, gsoType := 20, byte(unix.VIRTIO_NET_HDR_GSO_TCPV4)
+	if v6 {
+		ipLen, gsoType = 40, unix.VIRTIO_NET_HDR_GSO_TCPV6
+	}
+
+	b := make([]byte, virtioNetHdrLen+ipLen+20+payload)
+	b[0] = unix.VIRTIO_NET_HDR_F_NEEDS_CSUM
+	b[1] = gsoType
+	binary.NativeEndian.PutUint16(b[2:], uint16(ipLen+20))
+	binary.NativeEndian.PutUint16(b[4:], uint16(mss))
+	binary.NativeEndian.PutUint16(b[6:], uint16(ipLen))
+	binary.NativeEndian.PutUint16(b[8:], 16)
+
+	ip := b[virtioNetHdrLen:]
+	if v6 {
+		ip[0] = 0x60
+		ip[6] = unix.IPPROTO_TCP
+		copy(ip[8:], net6(1))
+		copy(ip[24:], net6(2))
+	} else {
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[4:], 100)
+		ip[9] = unix.IPPROTO_TCP
+		copy(ip[12:], []byte{172, 16, 0, 2, 10, 0, 0, 1})
+	}
+
+	tcp := ip[ipLen:]
+	binary.BigEndian.PutUint32(tcp[4:], 1000)
+	tcp[12] = 5 << 4
+	tcp[13] = tcpFlagFIN | tcpFlagPSH | 0x10
+	for i := range tcp[20:] {
+		tcp[20+i] = byte(i)
+	}
+	return b
+}
+
+func net6(n byte) []byte {
+	return []byte{0xfd, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, n}
+}
+
+func TestGSOReader(t *testing.T) {
+	for _, v6 := range []bool{false, true} {
+		ipLen := 20
+		if v6 {
+			ipLen = 40
+		}
+		g := newGSOReader(bytes.NewReader(gsoPacket(v6, 2500, 1000)))
+		buf := make([]byte, defaultBufferSize)
+
+		for i, size := range []int{1000, 1000, 500} {
+			n, err := g.Read(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pkt := buf[:n]
+			if n != ipLen+20+size {
+				t.Fatalf("segment %d: unexpected size %d", i, n)
+			}
+
+			ip, tcp := pkt[:ipLen], pkt[ipLen:]
+			var sum uint32
+			if v6 {
+				if v := binary.BigEndian.Uint16(ip[4:]); int(v) != 20+size {
+					t.Errorf("segment %d: unexpected payload length %d", i, v)
+				}
+				sum = checksum(ip[8:40], 0)
+			} else {
+				if v := binary.BigEndian.Uint16(ip[2:]); int(v) != n {
+					t.Errorf("segment %d: unexpected total length %d", i, v)
+				}
+				if v := binary.BigEndian.Uint16(ip[4:]); int(v) != 100+i {
+					t.Errorf("segment %d: unexpected IP ID %d", i, v)
+				}
+				if v := foldChecksum(checksum(ip, 0)); v != 0 {
+					t.Errorf("segment %d: invalid IP checksum", i)
+				}
+				sum = checksum(ip[12:20], 0)
+			}
+
+			if v := binary.BigEndian.Uint32(tcp[4:]); v != uint32(1000+i*1000) {
+				t.Errorf("segment %d: unexpected sequence number %d", i, v)
+			}
+			if v := foldChecksum(checksum(tcp, sum+unix.IPPROTO_TCP+uint32(len(tcp)))); v != 0 {
+				t.Errorf("segment %d: invalid TCP checksum", i)
+			}
+			if last := i == 2; (tcp[13]&tcpFlagFIN != 0) != last || (tcp[13]&tcpFlagPSH != 0) != last {
+				t.Errorf("segment %d: unexpected TCP flags %x", i, tcp[13])
+			}
+			if tcp[20] != byte(i*1000) {
+				t.Errorf("segment %d: unexpected payload", i)
+			}
+		}
+
+		if g.pkt != nil {
+			t.Error("GSO packet was not consumed")
+		}
+	}
+}
+
+func TestGSOReaderECN(t *testing.T) {
+	pkt := gsoPacket(false, 2500, 1000)
+	pkt[1] |= unix.VIRTIO_NET_HDR_GSO_ECN
+	pkt[virtioNetHdrLen+20+13] |= tcpFlagCWR
+	g := newGSOReader(bytes.NewReader(pkt))
+	buf := make([]byte, defaultBufferSize)
+
+	for i := 0; i < 3; i++ {
+		n, err := g.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cwr := buf[:n][20+13]&tcpFlagCWR != 0; cwr != (i == 0) {
+			t.Errorf("segment %d: unexpected CWR flag %t", i, cwr)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package link
+
+import (
+	"bufio"
+	"fmt"
+)
+
+// RFC 1662 HDLC-like framing
+const (
+	hdlcFlag   = 0x7e
+	hdlcEscape = 0x7d
+	hdlcXor    = 0x20
+	fcsInit    = 0xffff
+	fcsGood    = 0xf0b8
+	fcsPoly    = 0x8408
+)
+
+var fcsTable = func() (t [256]uint16) {
+	for i := range t {
+		v := uint16(i)
+		for j := 0; j < 8; j++ {
+			if v&1 != 0 {
+				v = v>>1 ^ fcsPoly
+			} else {
+				v >>= 1
+			}
+		}
+		t[i] = v
+	}
+	return
+}()
+
+// fcs16 updates the FCS-16 with the data
+func fcs16(fcs uint16, b []byte) uint16 {
+	for _, v := range b {
+		fcs = fcs>>8 ^ fcsTable[byte(fcs)^v]
+	}
+	return fcs
+}
+
+// isLCP reports, whether the PPP frame is an LCP frame, which must be sent
+// with the default ACCM, i.e. all control characters are escaped
+func isLCP(frame []byte) bool {
+	return len(frame) >= 4 && frame[0] == 0xff && frame[1] == 0x03 && frame[2] == 0xc0 && frame[3] == 0x21
+}
+
+// appendEscaped appends the data, escaping the flag, the escape and the
+// control characters, which are set in the ACCM
+func appendEscaped(dst, b []byte, accm uint32) []byte {
+	for _, v := range b {
+		if v == hdlcFlag || v == hdlcEscape || v < 0x20 && accm&(1<<v) != 0 {
+			dst = append(dst, hdlcEscape, v^hdlcXor)
+			continue
+		}
+		dst = append(dst, v)
+	}
+	return dst
+}
+
+// appendHDLC appends an HDLC frame with the PPP protocol prefix and the
+// payload, the negotiated ACCM is used for non LCP frames
+func appendHDLC(dst, proto, payload []byte, accm uint32) []byte {
+	if isLCP(payload) {
+		accm = 0xffffffff
+	}
+
+	fcs := ^fcs16(fcs16(fcsInit, proto), payload)
+
+	dst = append(dst, hdlcFlag)
+	dst = appendEscaped(dst, proto, accm)
+	dst = appendEscaped(dst, payload, accm)
+	dst = appendEscaped(dst, []byte{byte(fcs), byte(fcs >> 8)}, accm)
+	return append(dst, hdlcFlag)
+}
+
+// readHDLC reads the next HDLC frame, unescapes it into the buf and validates
+// the FCS, the returned frame doesn't contain the FCS
+func readHDLC(r *bufio.Reader, buf []byte) ([]byte, error) {
+	for {
+		b, err := r.ReadSlice(hdlcFlag)
+		if err != nil {
+			if err == bufio.ErrBufferFull {
+				return nil, fmt.Errorf("HDLC frame exceeds the %d buffer", r.Size())
+			}
+			return nil, fmt.Errorf("failed to read HDLC frame: %s", err)
+		}
+		// skip the flag
+		b = b[:len(b)-1]
+		if len(b) == 0 {
+			// opening flag or an empty frame
+			continue
+		}
+
+		n := 0
+		escaped := false
+		for _, v := range b {
+			if v == hdlcEscape {
+				escaped = true
+				continue
+			}
+			if n == len(buf) {
+				return nil, fmt.Errorf("HDLC frame exceeds the %d buffer", len(buf))
+			}
+			if escaped {
+				v ^= hdlcXor
+				escaped = false
+			}
+			buf[n] = v
+			n++
+		}
+
+		if escaped || n < 3 {
+			return nil, fmt.Errorf("invalid HDLC frame of the %d size", n)
+		}
+		if fcs := fcs16(fcsInit, buf[:n]); fcs != fcsGood {
+			return nil, fmt.Errorf("invalid HDLC frame FCS: %04x", fcs)
+		}
+
+		return buf[:n-2], nil
+	}
+}
+
+// compressPPP strips the address and control fields from the non LCP frames
+// and compresses the IP protocol fields, as they are sent with the F5 framing
+func compressPPP(frame []byte) []byte {
+	if len(frame) >= 4 && frame[0] == 0xff && frame[1] == 0x03 && !isLCP(frame) {
+		frame = frame[2:]
+	}
+	if len(frame) >= 2 && frame[0] == 0x00 && (frame[1] == ipv4header[0] || frame[1] == ipv6header[0]) {
+		frame = frame[1:]
+	}
+	return frame
+}
@@ -0,0 +1,120 @@
+package link
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// hdlcFrames encodes hex PPP frames into the HDLC framing
+func hdlcFrames(t testing.TB, frames ...string) []byte {
+	var buf []byte
+	for _, v := range frames {
+		b, err := hex.DecodeString(strings.ReplaceAll(v, " ", ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf = appendHDLC(buf, nil, b, 0)
+	}
+	return buf
+}
+
+func TestHDLC(t *testing.T) {
+	lcp := []byte{0xff, 0x03, 0xc0, 0x21, 0x09, 0x7e, 0x00, 0x08, 0x7d, 0x00, 0x00, 0x00}
+	pkt := []byte{0x45, 0x00, 0x7e, 0x01, 0x7d, 0x11}
+
+	var buf []byte
+	buf = appendHDLC(buf, nil, lcp, 0)
+	buf = appendHDLC(buf, ipv4header, pkt, 0)
+
+	// LCP frames are sent with the default ACCM
+	if i := bytes.IndexFunc(buf[:bytes.IndexByte(buf[1:], hdlcFlag)], func(r rune) bool { return r < 0x20 }); i >= 0 {
+		t.Errorf("LCP frame contains unescaped control characters: %x", buf)
+	}
+
+	r := bufio.NewReader(bytes.NewReader(buf))
+	dst := make([]byte, defaultBufferSize)
+	for _, expected := range [][]byte{lcp, append(ipv4header, pkt...)} {
+		frame, err := readHDLC(r, dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(frame, expected) {
+			t.Errorf("unexpected frame %x, expected %x", frame, expected)
+		}
+	}
+
+	// corrupted frame
+	buf = appendHDLC(nil, ipv4header, pkt, 0)
+	buf[2] ^= 0xff
+	if _, err := readHDLC(bufio.NewReader(bytes.NewReader(buf)), dst); err == nil {
+		t.Error("expected FCS error")
+	}
+}
+
+func TestFromF5HDLC(t *testing.T) {
+	frames := append([]string(nil), negotiation...)
+	// the address and control fields and uncompressed IP protocol
+	frames[len(frames)-1] = "ff03 0021 4500001c0000000040110000ac1000020a000001 0035003500080000"
+
+	l := newFuzzLink(hdlcFrames(t, frames...))
+	for range frames {
+		if err := fromF5(l); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !l.hdlc || !l.writer.hdlc {
+		t.Error("HDLC framing was not detected")
+	}
+	if v := l.localIPv4.String(); v != "172.16.0.2" {
+		t.Errorf("local IP is %s, expected 172.16.0.2", v)
+	}
+}
+
+func TestFromF5HDLCACCM(t *testing.T) {
+	frames := []string{
+		"ff03 c021 01 01 0018 0104 0534 0206000a0000 0506 deadbeef 0702 0802",
+		"ff03 c021 02 01 000e 020600000000 0702 0802",
+		"ff03 c021 01 07 0012 0104 0534 0206000a0000 0702 0802",
+	}
+
+	l := newFuzzLink(hdlcFrames(t, frames...))
+	sent := &bytes.Buffer{}
+	l.writer.w = sent
+	for range frames {
+		if err := fromF5(l); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if l.writer.accm != 0x000a0000 {
+		t.Errorf("peer ACCM is %08x, expected 000a0000", l.writer.accm)
+	}
+
+	// XON is escaped with the negotiated ACCM
+	if err := l.writer.writeFrame(nil, ipv4header, []byte{0x45, 0x11}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.writer.flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := bufio.NewReader(bytes.NewReader(sent.Bytes()))
+	dst := make([]byte, defaultBufferSize)
+	var replies []string
+	for {
+		frame, err := readHDLC(r, dst)
+		if err != nil {
+			break
+		}
+		replies = append(replies, hex.EncodeToString(frame))
+	}
+	ack := "ff03c02102070012010405340206000a000007020802"
+	if !strings.Contains(strings.Join(replies, " "), ack) {
+		t.Errorf("Configure-Ack with the peer ACCM is missing in %q", replies)
+	}
+	if !bytes.Contains(sent.Bytes(), []byte{0x45, hdlcEscape, 0x11 ^ 0x20}) {
+		t.Errorf("XON is not escaped: %x", sent.Bytes())
+	}
+}
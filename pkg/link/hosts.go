@@ -0,0 +1,112 @@
+package link
+
+import (
+	"context"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/kayrus/gof5/pkg/config"
+)
+
+const (
+	// route hostnames are resolved again with this interval
+	hostsResolveInterval = time.Minute
+	hostsResolveTimeout  = 10 * time.Second
+)
+
+// lookupHost is replaced in tests
+var lookupHost = func(ctx context.Context, host string) ([]net.IP, error) {
+	return net.DefaultResolver.LookupIP(ctx, "ip", host)
+}
+
+// hostNets returns the resolved addresses of the hostnames, the IPv6
+// addresses are skipped, when IPv6 is disabled
+func (l *vpnLink) hostNets(hosts []string, ipv6 bool) []*net.IPNet {
+	var res []*net.IPNet
+	for _, h := range hosts {
+		for _, ip := range l.resolved[h] {
+			if ip.To4() != nil || ipv6 {
+				res = append(res, hostNet(ip))
+			}
+		}
+	}
+	return res
+}
+
+// startHostsWatcher starts resolving the route hostnames, the addresses are
+// resolved after the routes are set, since the VPN DNS servers may be
+// reachable only via VPN
+func (l *vpnLink) startHostsWatcher(cfg *config.Config) {
+	if l.watching || len(cfg.RouteHosts) == 0 && len(cfg.ExcludeRouteHosts) == 0 {
+		return
+	}
+	l.watching = true
+	go l.watchHosts(cfg)
+}
+
+func (l *vpnLink) watchHosts(cfg *config.Config) {
+	t := time.NewTicker(hostsResolveInterval)
+	defer t.Stop()
+
+	for {
+		if err := l.refreshHosts(cfg); err != nil {
+			routeLog.Error("Failed to update hostname routes", "err", err)
+		}
+		select {
+		case <-l.TunDown:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// refreshHosts resolves the route hostnames and updates the routes, when the
+// addresses are changed. The previous addresses are kept on lookup errors.
+func (l *vpnLink) refreshHosts(cfg *config.Config) error {
+	l.Lock()
+	hosts := append(append([]string(nil), cfg.RouteHosts...), cfg.ExcludeRouteHosts...)
+	l.Unlock()
+
+	resolved := make(map[string][]net.IP, len(hosts))
+	for _, h := range hosts {
+		ctx, cancel := context.WithTimeout(context.Background(), hostsResolveTimeout)
+		ips, err := lookupHost(ctx, h)
+		cancel()
+		if err != nil {
+			routeLog.Warn("Failed to resolve route hostname", "host", h, "err", err)
+			continue
+		}
+		sort.Slice(ips, func(i, j int) bool {
+			return string(ips[i].To16()) < string(ips[j].To16())
+		})
+		resolved[h] = ips
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	select {
+	case <-l.TunDown:
+		// routes are being removed
+		return nil
+	default:
+	}
+
+	if l.resolved == nil {
+		l.resolved = make(map[string][]net.IP)
+	}
+	changed := false
+	for h, ips := range resolved {
+		if !ipsEqual(l.resolved[h], ips) {
+			routeLog.Info("Route hostname resolved", "host", h, "addresses", ips)
+			l.resolved[h] = ips
+			changed = true
+		}
+	}
+	if !changed || l.routeHandler == nil {
+		return nil
+	}
+
+	return l.updateRoutes(cfg)
+}
@@ -0,0 +1,105 @@
+package link
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/IBM/netaddr"
+	"github.com/kayrus/gof5/pkg/f5test"
+)
+
+func TestRefreshHosts(t *testing.T) {
+	addrs := map[string][]net.IP{
+		"git.corp.example": {net.IPv4(192, 168, 50, 10)},
+	}
+	lookupHost = func(_ context.Context, host string) ([]net.IP, error) {
+		if v, ok := addrs[host]; ok {
+			return v, nil
+		}
+		return nil, fmt.Errorf("no such host")
+	}
+	defer func() {
+		lookupHost = func(ctx context.Context, host string) ([]net.IP, error) {
+			return net.DefaultResolver.LookupIP(ctx, "ip", host)
+		}
+	}()
+
+	events := &f5test.Events{}
+	l, cfg := newTestLink(t, events)
+	cfg.RouteHosts = []string{"git.corp.example"}
+	// the watcher is not started, the hostnames are resolved explicitly
+	l.watching = true
+
+	close(l.pppUp)
+	l.WaitAndConfig(cfg)
+	if err := l.refreshHosts(cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkEvents(t, events,
+		"tun open",
+		"resolv set [10.0.0.53]",
+		"route add [10.0.0.0/8]",
+		"route add [192.168.50.10/32]",
+	)
+
+	// the address is changed
+	addrs["git.corp.example"] = []net.IP{net.IPv4(192, 168, 50, 20)}
+	if err := l.refreshHosts(cfg); err != nil {
+		t.Fatal(err)
+	}
+	// the previous address is kept on errors
+	delete(addrs, "git.corp.example")
+	if err := l.refreshHosts(cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkEvents(t, events,
+		"tun open",
+		"resolv set [10.0.0.53]",
+		"route add [10.0.0.0/8]",
+		"route add [192.168.50.10/32]",
+		"route add [192.168.50.20/32]",
+		"route del [192.168.50.10/32]",
+	)
+	if v := fmt.Sprint(l.routes); v != "[10.0.0.0/8 192.168.50.20/32]" {
+		t.Errorf("unexpected routes: %s", v)
+	}
+}
+
+func TestBuildRoutesExclude(t *testing.T) {
+	l, cfg := newTestLink(t, nil)
+	cfg.ExcludeRouteHosts = []string{"ci.corp.example"}
+	cfg.ExcludeRoutes = &netaddr.IPSet{}
+	cfg.ExcludeRoutes.InsertNet(cidrs("10.128.0.0/9")[0])
+	l.resolved = map[string][]net.IP{
+		"ci.corp.example": {net.IPv4(10, 64, 0, 0)},
+	}
+
+	routes := l.buildRoutes(cfg)
+	for _, ip := range []string{"10.64.0.0", "10.200.0.1"} {
+		for _, n := range routes {
+			if n.Contains(net.ParseIP(ip)) {
+				t.Errorf("excluded %s is routed via %s", ip, n)
+			}
+		}
+	}
+	// the source routes are not changed
+	if v := cfg.Routes.GetNetworks(); len(v) != 1 {
+		t.Errorf("source routes were modified: %s", v)
+	}
+}
+
+func TestHostNets(t *testing.T) {
+	l := &vpnLink{resolved: map[string][]net.IP{
+		"git.corp.example": {net.IPv4(192, 168, 50, 10), net.ParseIP("fd00::10")},
+		"v6.corp.example":  {net.ParseIP("fd00::20")},
+	}}
+	hosts := []string{"git.corp.example", "v6.corp.example"}
+	if v := fmt.Sprint(l.hostNets(hosts, false)); v != "[192.168.50.10/32]" {
+		t.Errorf("unexpected IPv4 host nets: %s", v)
+	}
+	if v := fmt.Sprint(l.hostNets(hosts, true)); v != "[192.168.50.10/32 fd00::10/128 fd00::20/128]" {
+		t.Errorf("unexpected host nets: %s", v)
+	}
+}
@@ -2,58 +2,120 @@ package link
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
 	"encoding/base64"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"math/rand"
 	"net"
 	"net/http"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/kayrus/gof5/pkg/config"
 	"github.com/kayrus/gof5/pkg/dns"
-
-	"github.com/fatih/color"
-	"github.com/kayrus/tuncfg/resolv"
-	"github.com/kayrus/tuncfg/route"
+	"github.com/kayrus/gof5/pkg/firewall"
+	"github.com/kayrus/gof5/pkg/hooks"
+	"github.com/kayrus/gof5/pkg/journal"
+	"github.com/kayrus/gof5/pkg/logging"
+	"github.com/kayrus/gof5/pkg/metrics"
+	"github.com/kayrus/gof5/pkg/pcap"
+	"github.com/kayrus/gof5/pkg/policy"
+
+	"github.com/IBM/netaddr"
 	"github.com/kayrus/tuncfg/tun"
 	"github.com/pion/dtls/v2"
 )
 
 const (
 	// TUN MTU should not be bigger than buffer size
-	bufferSize   = 1500
-	userAgentVPN = "Mozilla/5.0 (compatible; MSIE 10.0; Windows NT 6.1; Trident/6.0; F5 Networks Client)"
+	defaultBufferSize = 1500
+	userAgentVPN      = "Mozilla/5.0 (compatible; MSIE 10.0; Windows NT 6.1; Trident/6.0; F5 Networks Client)"
+	// buffered HTTP reader size, must fit the biggest F5 frame
+	readBufferSize = 32 << 10
+	// F5 frames are coalesced up to the TLS record size
+	coalesceSize = 16 << 10
+	// LCP echo requests interval, used to measure the tunnel RTT
+	lcpEchoInterval = 10 * time.Second
+	// capture interfaces
+	pcapIP  = 0
+	pcapPPP = 1
 )
 
-var colorlog = log.New(color.Error, "", log.LstdFlags)
+var (
+	pppLog   = logging.For(logging.PPP)
+	dnsLog   = logging.For(logging.DNS)
+	routeLog = logging.For(logging.Route)
+)
 
 type vpnLink struct {
 	sync.Mutex
-	HTTPConn    io.ReadWriteCloser
+	HTTPConn io.ReadWriteCloser
+	// buffered HTTPConn reader and F5 frames writer
+	reader *bufio.Reader
+	writer *frameWriter
+	// optional tunnel packets capture
+	Pcap *pcap.Writer
+	// the link replaces a previous tunnel, onReconnect hook is used
+	Reconnected bool
+	// TUN, routes and DNS handlers
+	Backend     Backend
 	ErrChan     chan error
 	TunDown     chan struct{}
 	PppdErrChan chan error
-	iface       io.ReadWriteCloser
+	iface       Device
 	name        string
+	server      string
 	// pppUp is used to wait for the PPP handshake (wireguard only)
 	pppUp chan struct{}
 	// tunUp is used to wait for the TUN interface (wireguard and pppd)
-	tunUp         chan struct{}
-	serverIPs     []net.IP
-	localIPv4     net.IP
-	serverIPv4    net.IP
-	localIPv6     net.IP
-	serverIPv6    net.IP
-	mtu           []byte
-	mtuInt        uint16
+	tunUp      chan struct{}
+	serverIPs  []net.IP
+	localIPv4  net.IP
+	serverIPv4 net.IP
+	localIPv6  net.IP
+	serverIPv6 net.IP
+	mtu        []byte
+	mtuInt     uint16
+	// configured TUN MTU, the LCP negotiated MTU is used, when zero
+	tunMTU int
+	// TUN read buffer size
+	bufferSize    int
 	debug         bool
-	routeHandler  *route.Handler
-	resolvHandler *resolv.Handler
+	routeHandler  Router
+	resolvHandler Resolver
+	dnsProtected  bool
+	// applied policy routing rules
+	rules *policy.Rules
+	// applied routes and gateway, used to calculate the reload delta
+	routes []*net.IPNet
+	gw     net.IP
+	// resolved route hostnames addresses
+	resolved map[string][]net.IP
+	watching bool
+	// tls or dtls
+	transport string
+	// routes and DNS are configured inside the network namespace, the host
+	// is not changed, thus there is nothing to journal
+	netns string
+	// HDLC framing is requested, the actual framing is detected by the
+	// first received byte
+	hdlc           bool
+	framingChecked bool
+	hdlcBuf        []byte
+	// the last sent LCP echo request
+	echo atomic.Pointer[lcpEcho]
+	// the server rejected the LCP echo requests
+	echoRejected atomic.Bool
+	// the tunnel was configured by the vpnc-script
+	scriptUp    bool
+	established bool
+	// the kill switch is enabled, it is not removed by RestoreConfig
+	killSwitch bool
 }
 
 func randomHostname(n int) []byte {
@@ -68,21 +130,35 @@ func randomHostname(n int) []byte {
 	return b
 }
 
+// LookupServer resolves the F5 server addresses. The result should be reused
+// during reconnects, since DNS may be unavailable when the kill switch is on.
+func LookupServer(server string) ([]net.IP, error) {
+	serverIPs, err := net.LookupIP(server)
+	if err != nil || len(serverIPs) == 0 {
+		return nil, fmt.Errorf("failed to resolve %s: %s", server, err)
+	}
+	return serverIPs, nil
+}
+
 // init a TLS connection
-func InitConnection(server string, cfg *config.Config, tlsConfig *tls.Config) (*vpnLink, error) {
+func InitConnection(server string, serverIPs []net.IP, cfg *config.Config, tlsConfig *tls.Config) (*vpnLink, error) {
+	// pppd always expects HDLC framing, some BIG-IP configs force it
+	hdlc := cfg.Driver == "pppd" || bool(cfg.F5Config.Object.HDLCFraming)
 	getURL := fmt.Sprintf("https://%s/myvpn?sess=%s&hostname=%s&hdlc_framing=%s&ipv4=%s&ipv6=%s&Z=%s",
 		server,
 		cfg.F5Config.Object.SessionID,
 		base64.StdEncoding.EncodeToString(randomHostname(8)),
-		config.Bool(cfg.Driver == "pppd"),
+		config.Bool(hdlc),
 		cfg.F5Config.Object.IPv4,
 		config.Bool(cfg.IPv6 && bool(cfg.F5Config.Object.IPv6)),
 		cfg.F5Config.Object.UrZ,
 	)
 
-	serverIPs, err := net.LookupIP(server)
-	if err != nil || len(serverIPs) == 0 {
-		return nil, fmt.Errorf("failed to resolve %s: %s", server, err)
+	var err error
+	dialer := &net.Dialer{}
+	if cfg.RouteTable != 0 {
+		// the F5 server traffic must bypass the VPN table
+		dialer.Control = policy.Control(excludeMark(cfg))
 	}
 
 	// define link channels
@@ -90,16 +166,29 @@ func InitConnection(server string, cfg *config.Config, tlsConfig *tls.Config) (*
 		ErrChan:     make(chan error, 1),
 		TunDown:     make(chan struct{}, 1),
 		PppdErrChan: make(chan error, 1),
+		server:      server,
 		serverIPs:   serverIPs,
 		pppUp:       make(chan struct{}, 1),
 		tunUp:       make(chan struct{}, 1),
-		debug:       cfg.Debug,
+		debug:       pppLog.Enabled(context.Background(), slog.LevelDebug),
+		transport:   "tls",
+		Backend:     NewSystemBackend(cfg),
+		tunMTU:      cfg.MTU,
+		bufferSize:  defaultBufferSize,
+		hdlc:        hdlc,
+	}
+	if cfg.BufferSize > 0 {
+		l.bufferSize = cfg.BufferSize
+	}
+	if cfg.Netns != "" {
+		l.Backend = NewNetnsBackend(cfg.Netns, cfg.TunQueues, cfg.TunOffload)
+		l.netns = cfg.Netns
 	}
 
 	if cfg.DTLS && cfg.F5Config.Object.TunnelDTLS {
 		s := fmt.Sprintf("%s:%s", server, cfg.F5Config.Object.TunnelPortDTLS)
-		log.Printf("Connecting to %s using DTLS", s)
-		addr, err := net.ResolveUDPAddr("udp", s)
+		slog.Info("Connecting using DTLS", "server", s)
+		addr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(serverIPs[0].String(), cfg.F5Config.Object.TunnelPortDTLS))
 		if err != nil {
 			return nil, fmt.Errorf("failed to resolve UDP address: %s", err)
 		}
@@ -109,14 +198,31 @@ func InitConnection(server string, cfg *config.Config, tlsConfig *tls.Config) (*
 			InsecureSkipVerify: tlsConfig.InsecureSkipVerify,
 			ServerName:         server,
 		}
-		l.HTTPConn, err = dtls.Dial("udp", addr, conf)
+		conn, err := dialer.Dial("udp", addr.String())
+		if err != nil {
+			return nil, fmt.Errorf("failed to dial %s:%s: %s", server, cfg.F5Config.Object.TunnelPortDTLS, err)
+		}
+		l.HTTPConn, err = dtls.Client(conn, conf)
 		if err != nil {
+			conn.Close()
 			return nil, fmt.Errorf("failed to dial %s:%s: %s", server, cfg.F5Config.Object.TunnelPortDTLS, err)
 		}
+		l.transport = "dtls"
 	} else {
-		l.HTTPConn, err = tls.Dial("tcp", fmt.Sprintf("%s:443", server), tlsConfig)
+		host, port := server, "443"
+		if h, p, err := net.SplitHostPort(server); err == nil {
+			host, port = h, p
+		}
+		conf := tlsConfig.Clone()
+		conf.ServerName = host
+		for _, ip := range serverIPs {
+			l.HTTPConn, err = tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(ip.String(), port), conf)
+			if err == nil {
+				break
+			}
+		}
 		if err != nil {
-			return nil, fmt.Errorf("failed to dial %s:443: %s", server, err)
+			return nil, fmt.Errorf("failed to dial %s:%s: %s", host, port, err)
 		}
 	}
 
@@ -130,11 +236,19 @@ func InitConnection(server string, cfg *config.Config, tlsConfig *tls.Config) (*
 		return nil, fmt.Errorf("failed to send VPN session request: %s", err)
 	}
 
-	if l.debug {
-		log.Printf("URL: %s", getURL)
+	pppLog.Debug("VPN session request", "url", getURL)
+
+	// DTLS datagrams must not be coalesced
+	limit := coalesceSize
+	if l.transport == "dtls" {
+		limit = 0
 	}
+	// an escaped HDLC frame may be twice bigger
+	l.reader = bufio.NewReaderSize(l.HTTPConn, max(readBufferSize, 2*l.maxFrameSize()+8))
+	l.writer = newFrameWriter(l.HTTPConn, limit, l.maxFrameSize())
+	l.writer.hdlc = l.hdlc
 
-	resp, err := http.ReadResponse(bufio.NewReader(l.HTTPConn), nil)
+	resp, err := http.ReadResponse(l.reader, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get initial VPN connection response: %s", err)
 	}
@@ -145,26 +259,46 @@ func InitConnection(server string, cfg *config.Config, tlsConfig *tls.Config) (*
 	l.localIPv6 = net.ParseIP(resp.Header.Get("X-VPN-client-IPv6"))
 	l.serverIPv6 = net.ParseIP(resp.Header.Get("X-VPN-server-IPv6"))
 
-	if l.debug {
-		log.Printf("Client IP: %s", l.localIPv4)
-		log.Printf("Server IP: %s", l.serverIPv4)
-		if l.localIPv6 != nil {
-			log.Printf("Client IPv6: %s", l.localIPv6)
-		}
-		if l.localIPv6 != nil {
-			log.Printf("Server IPv6: %s", l.serverIPv6)
-		}
-	}
+	pppLog.Debug("VPN session addresses",
+		"clientIP", l.localIPv4,
+		"serverIP", l.serverIPv4,
+		"clientIPv6", l.localIPv6,
+		"serverIPv6", l.serverIPv6,
+	)
 
 	return l, nil
 }
 
+// maxFrameSize returns the biggest F5 frame payload: PPP address, control and
+// protocol fields and the buffer sized packet
+func (l *vpnLink) maxFrameSize() int {
+	return l.bufferSize + 4
+}
+
+// tunnelMTU returns the TUN interface MTU
+func (l *vpnLink) tunnelMTU() int {
+	if l.tunMTU > 0 {
+		return l.tunMTU
+	}
+	return int(l.mtuInt)
+}
+
+// pathMTU returns the biggest packet size, which fits both the TUN interface
+// and the negotiated MTU
+func (l *vpnLink) pathMTU() int {
+	return min(l.tunnelMTU(), int(l.mtuInt))
+}
+
 func (l *vpnLink) createTunDevice() error {
-	if l.mtuInt+tun.Offset > bufferSize {
-		return fmt.Errorf("MTU exceeds the %d buffer limit", bufferSize)
+	mtu := l.tunnelMTU()
+	if mtu+tun.Offset > l.bufferSize {
+		return fmt.Errorf("MTU %d exceeds the %d buffer limit", mtu, l.bufferSize)
+	}
+	if mtu > int(l.mtuInt) {
+		pppLog.Warn("TUN MTU exceeds the negotiated MTU, oversized packets are rejected", "mtu", mtu, "negotiated", l.mtuInt)
 	}
 
-	log.Printf("Using wireguard module to create tunnel")
+	slog.Info("Using wireguard module to create tunnel")
 	ifname := ""
 	switch runtime.GOOS {
 	case "darwin":
@@ -181,20 +315,24 @@ func (l *vpnLink) createTunDevice() error {
 		IP:   l.serverIPv4,
 		Mask: net.CIDRMask(32, 32),
 	}
-	tunDev, err := tun.OpenTunDevice(local, gw, ifname, int(l.mtuInt))
+	tunDev, err := l.Backend.OpenTun(local, gw, ifname, mtu)
 	if err != nil {
 		return fmt.Errorf("failed to create an interface: %s", err)
 	}
 	l.name, err = tunDev.Name()
 	if err != nil {
 		if e := tunDev.Close(); e != nil {
-			log.Printf("error closing interface: %v", e)
+			slog.Error("Failed to close interface", "err", e)
 		}
 		return fmt.Errorf("failed to get an interface name: %s", err)
 	}
 
-	log.Printf("Created %s interface", l.name)
-	l.iface = &tun.Tunnel{NativeTun: tunDev}
+	if l.netns != "" {
+		slog.Info("Created interface", "name", l.name, "netns", l.netns)
+	} else {
+		slog.Info("Created interface", "name", l.name)
+	}
+	l.iface = tunDev
 
 	// can now process the traffic
 	close(l.tunUp)
@@ -204,10 +342,7 @@ func (l *vpnLink) createTunDevice() error {
 
 func (l *vpnLink) configureDNS(cfg *config.Config) error {
 	var err error
-	// this is used only in linux/freebsd to store /etc/resolv.conf backup
-	resolv.AppName = "gof5"
 
-	dnsSuffixes := cfg.F5Config.Object.DNSSuffix
 	var dnsServers []net.IP
 	if len(cfg.DNS) == 0 {
 		// route everything through VPN gatewy
@@ -218,7 +353,7 @@ func (l *vpnLink) configureDNS(cfg *config.Config) error {
 	}
 
 	// define DNS servers, provided by F5
-	l.resolvHandler, err = resolv.New(l.name, dnsServers, dnsSuffixes, cfg.RewriteResolv)
+	l.resolvHandler, err = l.Backend.NewResolver(l.name, dnsServers, cfg.F5Config.Object.DNSSuffix, cfg.RewriteResolv)
 	if err != nil {
 		return err
 	}
@@ -232,33 +367,28 @@ func (l *vpnLink) configureDNS(cfg *config.Config) error {
 	}
 
 	if len(cfg.DNS) > 0 && !l.resolvHandler.IsResolve() {
-		// combine local network search with VPN gateway search
-		dnsSuffixes = l.resolvHandler.GetOriginalSuffixes()
-		existingSuffixes := make(map[string]bool)
-		for _, existingSuffix := range dnsSuffixes {
-			existingSuffixes[existingSuffix] = true
-		}
-
-		for _, newSuffix := range cfg.F5Config.Object.DNSSuffix {
-			if !existingSuffixes[newSuffix] {
-				dnsSuffixes = append(dnsSuffixes, newSuffix)
-			}
-		}
-		l.resolvHandler.SetSuffixes(dnsSuffixes)
+		l.resolvHandler.SetSuffixes(l.dnsSuffixes(cfg))
 	}
 
 	if l.resolvHandler.IsResolve() {
 		// resolve daemon will route necessary domains through VPN gatewy
-		log.Printf("Detected systemd-resolved")
+		dnsLog.Info("Detected systemd-resolved")
 		l.resolvHandler.SetDNSServers(cfg.F5Config.Object.DNS)
 		if len(cfg.DNS) > 0 {
-			log.Printf("Forwarding %q DNS requests to %q", cfg.DNS, cfg.F5Config.Object.DNS)
-			l.resolvHandler.SetDNSDomains(cfg.DNS)
-			log.Printf("Default DNS servers: %q", l.resolvHandler.GetOriginalDNS())
+			dnsLog.Info("Forwarding DNS requests", "zones", cfg.DNS, "servers", cfg.F5Config.Object.DNS)
+			dnsLog.Info("Default DNS servers", "servers", l.resolvHandler.GetOriginalDNS())
 		} else {
 			// route all DNS queries via VPN
-			log.Printf("Forwarding all DNS requests to %q", cfg.F5Config.Object.DNS)
-			l.resolvHandler.SetDNSDomains([]string{"."})
+			dnsLog.Info("Forwarding all DNS requests", "servers", cfg.F5Config.Object.DNS)
+		}
+		l.resolvHandler.SetDNSDomains(dnsDomains(cfg))
+	}
+
+	// persist the original DNS settings to restore them after a crash
+	if l.netns == "" {
+		err = journal.Record(cfg.Path, journal.ResolvEntry(l.name, l.resolvHandler, cfg.RewriteResolv))
+		if err != nil {
+			return err
 		}
 	}
 
@@ -270,23 +400,230 @@ func (l *vpnLink) configureDNS(cfg *config.Config) error {
 
 	if !l.resolvHandler.IsResolve() {
 		if len(cfg.DNS) == 0 {
-			log.Printf("Forwarding all DNS requests to %q", cfg.F5Config.Object.DNS)
+			dnsLog.Info("Forwarding all DNS requests", "servers", cfg.F5Config.Object.DNS)
 			return nil
 		}
 		cfg.DNSServers = l.resolvHandler.GetOriginalDNS()
-		log.Printf("Serving DNS proxy on %s:53", cfg.ListenDNS)
-		log.Printf("Forwarding %q DNS requests to %q", cfg.DNS, cfg.F5Config.Object.DNS)
-		log.Printf("Default DNS servers: %q", cfg.DNSServers)
+		dnsLog.Info("Serving DNS proxy", "listen", net.JoinHostPort(cfg.ListenDNS.String(), "53"))
+		dnsLog.Info("Forwarding DNS requests", "zones", cfg.DNS, "servers", cfg.F5Config.Object.DNS)
+		dnsLog.Info("Default DNS servers", "servers", cfg.DNSServers)
 		dns.Start(cfg, l.ErrChan, l.TunDown)
 	}
 
 	return nil
 }
 
+// hostNet returns the single address network
+func hostNet(ip net.IP) *net.IPNet {
+	if v := ip.To4(); v != nil {
+		return &net.IPNet{IP: v, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+// buildRoutes returns the F5 routes merged with the custom routes and the
+// resolved hostnames according to the routes mode, without the excluded
+// routes, the F5 gateway and the local DNS servers
+func (l *vpnLink) buildRoutes(cfg *config.Config) []*net.IPNet {
+	custom := cfg.Routes != nil
+	mode := cfg.RoutesMode
+	if mode == "" {
+		mode = "replace"
+	}
+
+	// the source sets must not be changed, the hostname addresses may change
+	routes := &netaddr.IPSet{}
+	if !custom || mode != "replace" {
+		f5Routes6 := cfg.F5Config.Object.Routes6
+		if !cfg.IPv6 {
+			f5Routes6 = nil
+		}
+		for _, v := range config.Networks(cfg.F5Config.Object.Routes, f5Routes6) {
+			routes.InsertNet(v)
+		}
+	}
+	if custom {
+		for _, v := range append(config.Networks(cfg.Routes, cfg.Routes6), l.hostNets(cfg.RouteHosts, cfg.IPv6)...) {
+			if mode == "subtract" {
+				routes.RemoveNet(v)
+			} else {
+				routes.InsertNet(v)
+			}
+		}
+	}
+	for _, v := range append(config.Networks(cfg.ExcludeRoutes, cfg.ExcludeRoutes6), l.hostNets(cfg.ExcludeRouteHosts, cfg.IPv6)...) {
+		routes.RemoveNet(v)
+	}
+
+	// exclude F5 gateway IPs
+	for _, dst := range l.serverIPs {
+		routes.RemoveNet(hostNet(dst))
+	}
+
+	if l.resolvHandler == nil {
+		return routes.GetNetworks()
+	}
+
+	// exclude local DNS servers, when they are not located inside the LAN
+	for _, v := range l.resolvHandler.GetOriginalDNS() {
+		routes.RemoveNet(hostNet(v))
+	}
+
+	return routes.GetNetworks()
+}
+
+// dnsSuffixes returns the DNS search suffixes, when the DNS proxy is used,
+// the local network suffixes are combined with the VPN gateway suffixes
+func (l *vpnLink) dnsSuffixes(cfg *config.Config) []string {
+	if len(cfg.DNS) == 0 || l.resolvHandler.IsResolve() {
+		return cfg.F5Config.Object.DNSSuffix
+	}
+
+	dnsSuffixes := l.resolvHandler.GetOriginalSuffixes()
+	existingSuffixes := make(map[string]bool)
+	for _, existingSuffix := range dnsSuffixes {
+		existingSuffixes[existingSuffix] = true
+	}
+
+	for _, newSuffix := range cfg.F5Config.Object.DNSSuffix {
+		if !existingSuffixes[newSuffix] {
+			dnsSuffixes = append(dnsSuffixes, newSuffix)
+		}
+	}
+	return dnsSuffixes
+}
+
+// dnsDomains returns the systemd-resolved routing domains
+func dnsDomains(cfg *config.Config) []string {
+	if len(cfg.DNS) > 0 {
+		return cfg.DNS
+	}
+	// route all DNS queries via VPN
+	return []string{"."}
+}
+
+// configureRoutes sets routes, pushed from F5 or defined in the config
+func (l *vpnLink) configureRoutes(cfg *config.Config) error {
+	routeLog.Info("Setting routes", "interface", l.name)
+
+	switch {
+	case cfg.Routes == nil:
+		routeLog.Info("Applying routes, pushed from F5 VPN server")
+	case cfg.RoutesMode == "append" || cfg.RoutesMode == "subtract":
+		routeLog.Info("Merging custom routes with routes, pushed from F5 VPN server", "mode", cfg.RoutesMode)
+	}
+
+	var gw net.IP
+	if runtime.GOOS == "windows" {
+		// windows requires both gateway and interface name
+		gw = l.serverIPv4
+	}
+
+	l.gw = gw
+	routes, err := l.checkConflicts(cfg, l.buildRoutes(cfg))
+	if err != nil {
+		return err
+	}
+	l.routes = routes
+	l.routeHandler, err = l.Backend.NewRouter(l.name, l.routes, gw)
+	if err != nil {
+		return err
+	}
+	if l.netns == "" {
+		err = journal.Record(cfg.Path, journal.RouteEntry(l.name, l.routes, gw, cfg.RouteTable))
+		if err != nil {
+			return err
+		}
+	}
+	l.routeHandler.Add()
+
+	if cfg.RouteTable != 0 {
+		rules := l.policyRules(cfg)
+		routeLog.Info("Setting policy routing rules", "rules", rules)
+		err = journal.Record(cfg.Path, journal.RuleEntry(l.name, rules))
+		if err != nil {
+			return err
+		}
+		l.rules = &rules
+		return rules.Set()
+	}
+
+	return nil
+}
+
+// excludeMark returns the F5 server connection mark
+func excludeMark(cfg *config.Config) int {
+	if cfg.RouteExcludeMark > 0 {
+		return cfg.RouteExcludeMark
+	}
+	return policy.DefaultExcludeMark
+}
+
+// policyRules returns the rules, which direct the traffic into the VPN table
+func (l *vpnLink) policyRules(cfg *config.Config) policy.Rules {
+	r := policy.Rules{
+		Table:       cfg.RouteTable,
+		Mode:        cfg.RouteRule,
+		Mark:        cfg.RouteMark,
+		ExcludeMark: excludeMark(cfg),
+	}
+	switch r.Mode {
+	case "":
+		r.Mode = policy.Destination
+	case policy.Source:
+		r.Sources = []net.IP{l.localIPv4}
+		if cfg.IPv6 && bool(cfg.F5Config.Object.IPv6) && l.localIPv6 != nil {
+			r.Sources = append(r.Sources, l.localIPv6)
+		}
+	}
+	return r
+}
+
+// hookEnv returns the hook scripts environment
+func (l *vpnLink) hookEnv(cfg *config.Config, reason string) *hooks.Env {
+	e := &hooks.Env{
+		Reason:      reason,
+		TunDev:      l.name,
+		ServerIPs:   l.serverIPs,
+		Server:      l.server,
+		Profile:     cfg.Profile,
+		IPv4:        l.localIPv4,
+		IPv6:        l.localIPv6,
+		MTU:         l.tunnelMTU(),
+		DNS:         cfg.F5Config.Object.DNS,
+		DNS6:        cfg.F5Config.Object.DNS6,
+		Domains:     cfg.F5Config.Object.DNSSuffix,
+		SplitDNS:    cfg.DNS,
+		Routes:      l.routes,
+		ExcludeNets: cfg.F5Config.Object.ExcludeSubnets,
+	}
+	for _, v := range l.serverIPs {
+		if v.To4() != nil {
+			e.Gateway = v
+			break
+		}
+	}
+	return e
+}
+
+// runHook executes an optional hook script, errors are only logged
+func (l *vpnLink) runHook(cfg *config.Config, path, reason string) {
+	if path == "" {
+		return
+	}
+	if err := hooks.Run(path, l.hookEnv(cfg, reason)); err != nil {
+		slog.Error("Hook script failed", "reason", reason, "err", err)
+	}
+}
+
 // wait for pppd and config DNS and routes
 func (l *vpnLink) WaitAndConfig(cfg *config.Config) {
 	// wait for ppp handshake completed
-	<-l.pppUp
+	select {
+	case <-l.pppUp:
+	case <-l.TunDown:
+		return
+	}
 
 	l.Lock()
 	defer l.Unlock()
@@ -294,73 +631,97 @@ func (l *vpnLink) WaitAndConfig(cfg *config.Config) {
 	var err error
 
 	if cfg.Driver != "pppd" {
+		if cfg.Script != "" {
+			err = hooks.Run(cfg.Script, l.hookEnv(cfg, hooks.PreInit))
+			if err != nil {
+				l.sendErr(err)
+				return
+			}
+		}
+
 		// create TUN
 		err = l.createTunDevice()
 		if err != nil {
-			l.ErrChan <- err
+			l.sendErr(err)
 			return
 		}
 		defer func() {
 			if err != nil && l.iface != nil {
 				// destroy interface on error
 				if e := l.iface.Close(); e != nil {
-					log.Printf("error closing interface: %v", e)
+					slog.Error("Failed to close interface", "err", e)
 				}
 			}
 		}()
 	}
 
-	err = l.configureDNS(cfg)
+	if cfg.Script != "" {
+		// the vpnc-script configures routes and DNS
+		l.routes = l.buildRoutes(cfg)
+		l.scriptUp = true
+		err = hooks.Run(cfg.Script, l.hookEnv(cfg, hooks.Connect))
+	} else {
+		err = l.configureDNS(cfg)
+		if err == nil {
+			err = l.configureRoutes(cfg)
+		}
+		if err == nil {
+			l.startHostsWatcher(cfg)
+		}
+	}
 	if err != nil {
-		l.ErrChan <- err
+		l.sendErr(err)
 		return
 	}
 
-	// set routes
-	log.Printf("Setting routes on %s interface", l.name)
-
-	// set custom routes
-	routes := cfg.Routes
-	if routes == nil {
-		log.Printf("Applying routes, pushed from F5 VPN server")
-		routes = cfg.F5Config.Object.Routes
-	}
-
-	// exclude F5 gateway IPs
-	for _, dst := range l.serverIPs {
-		// exclude only ipv4
-		if v := dst.To4(); v != nil {
-			local := &net.IPNet{
-				IP:   v,
-				Mask: net.CIDRMask(32, 32),
-			}
-			routes.RemoveNet(local)
+	if cfg.DNSLeakProtection {
+		dnsLog.Info("Enabling DNS leak protection")
+		allowed := append([]net.IP{cfg.ListenDNS}, cfg.F5Config.Object.DNS...)
+		allowed = append(allowed, cfg.F5Config.Object.DNS6...)
+		err = journal.Record(cfg.Path, journal.Entry{Type: journal.DNSLeak})
+		if err != nil {
+			l.sendErr(err)
+			return
+		}
+		l.dnsProtected = true
+		err = firewall.SetDNSLeakProtection(allowed)
+		if err != nil {
+			l.sendErr(err)
+			return
 		}
 	}
 
-	// exclude local DNS servers, when they are not located inside the LAN
-	for _, v := range l.resolvHandler.GetOriginalDNS() {
-		localDNS := &net.IPNet{
-			IP:   v,
-			Mask: net.CIDRMask(32, 32),
+	if cfg.KillSwitch {
+		slog.Info("Enabling kill switch")
+		err = journal.Record(cfg.Path, journal.Entry{Type: journal.KillSwitch})
+		if err != nil {
+			l.sendErr(err)
+			return
+		}
+		err = firewall.SetKillSwitch(l.name, l.serverIPs, cfg.KillSwitchAllowLAN)
+		if err != nil {
+			l.sendErr(err)
+			return
 		}
-		routes.RemoveNet(localDNS)
+		l.killSwitch = true
 	}
 
-	var gw net.IP
-	if runtime.GOOS == "windows" {
-		// windows requires both gateway and interface name
-		gw = l.serverIPv4
-	}
+	metrics.SessionUp(l.transport)
+	slog.Info("Connection established", "interface", l.name, "transport", l.transport)
+	l.established = true
 
-	l.routeHandler, err = route.New(l.name, routes.GetNetworks(), gw, 0)
-	if err != nil {
-		l.ErrChan <- err
-		return
+	if l.Reconnected && cfg.OnReconnect != "" {
+		l.runHook(cfg, cfg.OnReconnect, hooks.Reconnect)
+	} else {
+		l.runHook(cfg, cfg.OnConnect, hooks.Connect)
 	}
-	l.routeHandler.Add()
+}
 
-	colorlog.Print(color.HiGreenString("Connection established"))
+// KillSwitch reports whether the kill switch was enabled by the link
+func (l *vpnLink) KillSwitch() bool {
+	l.Lock()
+	defer l.Unlock()
+	return l.killSwitch
 }
 
 // restore config
@@ -368,15 +729,52 @@ func (l *vpnLink) RestoreConfig(cfg *config.Config) {
 	l.Lock()
 	defer l.Unlock()
 
+	metrics.SessionDown()
+
+	if l.established {
+		l.runHook(cfg, cfg.OnDisconnect, hooks.Disconnect)
+	}
+
+	if l.scriptUp {
+		if err := hooks.Run(cfg.Script, l.hookEnv(cfg, hooks.Disconnect)); err != nil {
+			slog.Error("Failed to run vpnc-script", "err", err)
+		}
+	}
+
+	if l.dnsProtected {
+		dnsLog.Info("Disabling DNS leak protection")
+		if err := firewall.RemoveDNSLeakProtection(); err != nil {
+			dnsLog.Error("Failed to disable DNS leak protection", "err", err)
+		} else if err := journal.Forget(cfg.Path, journal.DNSLeak, ""); err != nil {
+			dnsLog.Error("Failed to update journal", "err", err)
+		}
+	}
+
 	if l.routeHandler != nil {
-		log.Printf("Removing routes from %s interface", l.name)
+		routeLog.Info("Removing routes", "interface", l.name)
 		l.routeHandler.Del()
+		if err := journal.Forget(cfg.Path, journal.Route, l.name); err != nil {
+			routeLog.Error("Failed to update journal", "err", err)
+		}
+	}
+
+	if l.rules != nil {
+		routeLog.Info("Removing policy routing rules", "rules", *l.rules)
+		if err := l.rules.Remove(); err != nil {
+			routeLog.Error("Failed to remove policy routing rules", "err", err)
+		}
+		if err := journal.Forget(cfg.Path, journal.Rule, l.name); err != nil {
+			routeLog.Error("Failed to update journal", "err", err)
+		}
 	}
 
 	if !cfg.DisableDNS {
 		if l.resolvHandler != nil {
-			log.Printf("Restoring DNS settings")
+			dnsLog.Info("Restoring DNS settings")
 			l.resolvHandler.Restore()
+			if err := journal.Forget(cfg.Path, journal.Resolv, l.name); err != nil {
+				dnsLog.Error("Failed to update journal", "err", err)
+			}
 		}
 	}
 
@@ -384,7 +782,7 @@ func (l *vpnLink) RestoreConfig(cfg *config.Config) {
 		if l.iface != nil {
 			err := l.iface.Close()
 			if err != nil {
-				log.Printf("error closing interface: %v", err)
+				slog.Error("Failed to close interface", "err", err)
 			}
 		}
 	}
@@ -0,0 +1,157 @@
+package link
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/IBM/netaddr"
+	"github.com/kayrus/gof5/pkg/config"
+	"github.com/kayrus/gof5/pkg/f5test"
+	"github.com/kayrus/gof5/pkg/policy"
+)
+
+func newTestLink(t *testing.T, events *f5test.Events) (*vpnLink, *config.Config) {
+	l := &vpnLink{
+		ErrChan:    make(chan error, 1),
+		TunDown:    make(chan struct{}),
+		pppUp:      make(chan struct{}),
+		tunUp:      make(chan struct{}),
+		serverIPs:  []net.IP{net.IPv4(192, 0, 2, 1)},
+		localIPv4:  net.IPv4(172, 16, 0, 2),
+		serverIPv4: net.IPv4(172, 16, 0, 1),
+		mtuInt:     1332,
+		bufferSize: defaultBufferSize,
+		transport:  "tls",
+		Backend: Backend{
+			OpenTun: func(_, _ *net.IPNet, _ string, _ int) (Device, error) {
+				events.Add("tun open")
+				dev := f5test.NewTun("tun0")
+				dev.Events = events
+				return dev, nil
+			},
+			NewRouter: func(_ string, routes []*net.IPNet, _ net.IP) (Router, error) {
+				return &f5test.Router{Events: events, Routes: routes}, nil
+			},
+			NewResolver: func(_ string, servers []net.IP, _ []string, _ bool) (Resolver, error) {
+				return &f5test.Resolver{Events: events, DNSServers: servers}, nil
+			},
+		},
+	}
+
+	routes := &netaddr.IPSet{}
+	_, n, _ := net.ParseCIDR("10.0.0.0/8")
+	routes.InsertNet(n)
+	cfg := &config.Config{
+		Driver: "wireguard",
+		Path:   t.TempDir(),
+		Routes: routes,
+		F5Config: &config.Favorite{
+			Object: config.Object{
+				DNS: []net.IP{net.IPv4(10, 0, 0, 53)},
+			},
+		},
+	}
+
+	return l, cfg
+}
+
+func checkEvents(t *testing.T, events *f5test.Events, expected ...string) {
+	t.Helper()
+	if v := events.List(); strings.Join(v, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected system changes:\n%s\nexpected:\n%s", strings.Join(v, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestWaitAndConfig(t *testing.T) {
+	events := &f5test.Events{}
+	l, cfg := newTestLink(t, events)
+
+	close(l.pppUp)
+	l.WaitAndConfig(cfg)
+	select {
+	case err := <-l.ErrChan:
+		t.Fatal(err)
+	default:
+	}
+	checkEvents(t, events,
+		"tun open",
+		"resolv set [10.0.0.53]",
+		"route add [10.0.0.0/8]",
+	)
+
+	l.RestoreConfig(cfg)
+	checkEvents(t, events,
+		"tun open",
+		"resolv set [10.0.0.53]",
+		"route add [10.0.0.0/8]",
+		"route del [10.0.0.0/8]",
+		"resolv restore",
+		"tun close",
+	)
+}
+
+func TestWaitAndConfigError(t *testing.T) {
+	events := &f5test.Events{}
+	l, cfg := newTestLink(t, events)
+	l.Backend.NewRouter = func(_ string, _ []*net.IPNet, _ net.IP) (Router, error) {
+		return nil, fmt.Errorf("route error")
+	}
+
+	close(l.pppUp)
+	l.WaitAndConfig(cfg)
+	select {
+	case err := <-l.ErrChan:
+		if err.Error() != "route error" {
+			t.Errorf("unexpected error: %v", err)
+		}
+	default:
+		t.Fatal("error was not reported")
+	}
+	// the interface is destroyed on error
+	checkEvents(t, events,
+		"tun open",
+		"resolv set [10.0.0.53]",
+		"tun close",
+	)
+
+	l.RestoreConfig(cfg)
+	checkEvents(t, events,
+		"tun open",
+		"resolv set [10.0.0.53]",
+		"tun close",
+		"resolv restore",
+	)
+}
+
+func TestWaitAndConfigTunDown(t *testing.T) {
+	events := &f5test.Events{}
+	l, cfg := newTestLink(t, events)
+
+	close(l.TunDown)
+	l.WaitAndConfig(cfg)
+	l.RestoreConfig(cfg)
+	checkEvents(t, events)
+}
+
+func TestPolicyRulesSources(t *testing.T) {
+	l, cfg := newTestLink(t, nil)
+	l.localIPv6 = bytesToIPv6([]byte{0, 0, 0, 0, 0, 0, 0, 2})
+	cfg.RouteRule = policy.Source
+
+	for _, v := range []struct {
+		ipv6, f5IPv6 bool
+		expected     string
+	}{
+		{false, true, "[172.16.0.2]"},
+		{true, false, "[172.16.0.2]"},
+		{true, true, "[172.16.0.2 fe80::2]"},
+	} {
+		cfg.IPv6 = v.ipv6
+		cfg.F5Config.Object.IPv6 = config.Bool(v.f5IPv6)
+		if s := fmt.Sprint(l.policyRules(cfg).Sources); s != v.expected {
+			t.Errorf("unexpected ipv6=%t/%t sources: %s", v.ipv6, v.f5IPv6, s)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package link
+
+import (
+	"encoding/binary"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	protoICMP   = 1
+	protoTCP    = 6
+	protoICMPv6 = 58
+	tcpFlagSYN  = 0x02
+	tcpOptMSS   = 2
+	// IPv6 minimum MTU, an ICMPv6 error must fit it
+	ipv6MinMTU = 1280
+	// ICMP error and ICMPv6 Packet Too Big message types
+	icmpUnreachable      = 3
+	icmpFragNeeded       = 4
+	icmpv6PacketTooBig   = 2
+	icmpHeaderLen        = 8
+	defaultHopLimit      = 64
+	ipv4FlagDontFragment = 0x40
+)
+
+// checksum returns the one's complement sum of the data
+func checksum(b []byte, sum uint32) uint32 {
+	for len(b) >= 2 {
+		sum += uint32(b[0])<<8 | uint32(b[1])
+		b = b[2:]
+	}
+	if len(b) == 1 {
+		sum += uint32(b[0]) << 8
+	}
+	return sum
+}
+
+func foldChecksum(sum uint32) uint16 {
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
+
+// updateChecksum incrementally updates the checksum, when a 16 bit word is
+// changed (RFC 1624)
+func updateChecksum(csum, old, new uint16) uint16 {
+	return foldChecksum(uint32(^csum) + uint32(^old) + uint32(new))
+}
+
+// tcpSegment returns the TCP segment of the unfragmented IP packet and the
+// IP header length
+func tcpSegment(pkt []byte) ([]byte, int) {
+	if len(pkt) == 0 {
+		return nil, 0
+	}
+	switch pkt[0] >> 4 {
+	case ipv4.Version:
+		if len(pkt) < ipv4.HeaderLen || pkt[9] != protoTCP {
+			return nil, 0
+		}
+		// fragment offset is not zero
+		if binary.BigEndian.Uint16(pkt[6:])&0x1fff != 0 {
+			return nil, 0
+		}
+		ihl := int(pkt[0]&0x0f) * 4
+		if ihl < ipv4.HeaderLen || len(pkt) < ihl+20 {
+			return nil, 0
+		}
+		return pkt[ihl:], ipv4.HeaderLen
+	case ipv6.Version:
+		// IPv6 extension headers are not supported
+		if len(pkt) < ipv6.HeaderLen+20 || pkt[6] != protoTCP {
+			return nil, 0
+		}
+		return pkt[ipv6.HeaderLen:], ipv6.HeaderLen
+	}
+	return nil, 0
+}
+
+// clampMSS lowers the MSS option of the TCP SYN packet to fit the MTU
+func clampMSS(pkt []byte, mtu int) {
+	tcp, ipLen := tcpSegment(pkt)
+	if tcp == nil || tcp[13]&tcpFlagSYN == 0 {
+		return
+	}
+
+	maxMSS := mtu - ipLen - 20
+	if maxMSS <= 0 {
+		return
+	}
+
+	doff := int(tcp[12]>>4) * 4
+	if doff > len(tcp) {
+		return
+	}
+	for opts := 20; opts < doff; {
+		switch kind := tcp[opts]; kind {
+		case 0:
+			// end of options
+			return
+		case 1:
+			// no operation
+			opts++
+			continue
+		}
+		if opts+1 >= doff {
+			return
+		}
+		optLen := int(tcp[opts+1])
+		if optLen < 2 || opts+optLen > doff {
+			return
+		}
+		if tcp[opts] == tcpOptMSS && optLen == 4 {
+			mss := binary.BigEndian.Uint16(tcp[opts+2:])
+			if int(mss) > maxMSS {
+				binary.BigEndian.PutUint16(tcp[opts+2:], uint16(maxMSS))
+				csum := binary.BigEndian.Uint16(tcp[16:])
+				binary.BigEndian.PutUint16(tcp[16:], updateChecksum(csum, mss, uint16(maxMSS)))
+			}
+			return
+		}
+		opts += optLen
+	}
+}
+
+// packetTooBig returns an ICMP "fragmentation needed" or an ICMPv6 "packet
+// too big" reply to the packet, which exceeds the MTU, the reply is built in
+// the buf. Nil is returned, when the packet can be fragmented or must not be
+// answered.
+func packetTooBig(pkt []byte, mtu int, buf []byte) []byte {
+	if mtu <= 0 || len(pkt) <= mtu {
+		return nil
+	}
+
+	switch pkt[0] >> 4 {
+	case ipv4.Version:
+		if len(pkt) < ipv4.HeaderLen || pkt[6]&ipv4FlagDontFragment == 0 || pkt[9] == protoICMP {
+			return nil
+		}
+		// the original IP header and 64 bits of the data
+		quote := int(pkt[0]&0x0f)*4 + 8
+		n := ipv4.HeaderLen + icmpHeaderLen + quote
+		if quote > len(pkt) || n > len(buf) {
+			return nil
+		}
+		b := buf[:n]
+		clear(b)
+		b[0] = 0x45
+		binary.BigEndian.PutUint16(b[2:], uint16(n))
+		b[8] = defaultHopLimit
+		b[9] = protoICMP
+		// swap the source and the destination
+		copy(b[12:16], pkt[16:20])
+		copy(b[16:20], pkt[12:16])
+		binary.BigEndian.PutUint16(b[10:], foldChecksum(checksum(b[:ipv4.HeaderLen], 0)))
+
+		icmp := b[ipv4.HeaderLen:]
+		icmp[0] = icmpUnreachable
+		icmp[1] = icmpFragNeeded
+		binary.BigEndian.PutUint16(icmp[6:], uint16(mtu))
+		copy(icmp[icmpHeaderLen:], pkt[:quote])
+		binary.BigEndian.PutUint16(icmp[2:], foldChecksum(checksum(icmp, 0)))
+		return b
+	case ipv6.Version:
+		if len(pkt) < ipv6.HeaderLen || pkt[6] == protoICMPv6 {
+			return nil
+		}
+		// as much of the original packet as fits the minimum MTU
+		quote := min(len(pkt), ipv6MinMTU-ipv6.HeaderLen-icmpHeaderLen)
+		n := ipv6.HeaderLen + icmpHeaderLen + quote
+		if n > len(buf) {
+			return nil
+		}
+		b := buf[:n]
+		clear(b)
+		b[0] = 0x60
+		binary.BigEndian.PutUint16(b[4:], uint16(n-ipv6.HeaderLen))
+		b[6] = protoICMPv6
+		b[7] = defaultHopLimit
+		copy(b[8:24], pkt[24:40])
+		copy(b[24:40], pkt[8:24])
+
+		icmp := b[ipv6.HeaderLen:]
+		icmp[0] = icmpv6PacketTooBig
+		binary.BigEndian.PutUint32(icmp[4:], uint32(mtu))
+		copy(icmp[icmpHeaderLen:], pkt[:quote])
+		sum := checksum(b[8:40], protoICMPv6+uint32(len(icmp)))
+		binary.BigEndian.PutUint16(icmp[2:], foldChecksum(checksum(icmp, sum)))
+		return b
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package link
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// tcpPacket returns an IPv4 TCP packet with the valid checksums
+func tcpPacket(size int, flags byte, mss uint16) []byte {
+	pkt := make([]byte, size)
+	pkt[0] = 0x45
+	binary.BigEndian.PutUint16(pkt[2:], uint16(size))
+	pkt[6] = ipv4FlagDontFragment
+	pkt[8] = defaultHopLimit
+	pkt[9] = protoTCP
+	copy(pkt[12:], []byte{172, 16, 0, 2, 10, 0, 0, 1})
+	binary.BigEndian.PutUint16(pkt[10:], foldChecksum(checksum(pkt[:20], 0)))
+
+	tcp := pkt[20:]
+	tcp[12] = 6 << 4
+	tcp[13] = flags
+	// MSS option
+	tcp[20], tcp[21] = tcpOptMSS, 4
+	binary.BigEndian.PutUint16(tcp[22:], mss)
+	sum := checksum(pkt[12:20], protoTCP+uint32(len(tcp)))
+	binary.BigEndian.PutUint16(tcp[16:], foldChecksum(checksum(tcp, sum)))
+	return pkt
+}
+
+func validTCPChecksum(pkt []byte) bool {
+	tcp := pkt[20:]
+	return foldChecksum(checksum(tcp, checksum(pkt[12:20], protoTCP+uint32(len(tcp))))) == 0
+}
+
+func TestClampMSS(t *testing.T) {
+	pkt := tcpPacket(44, tcpFlagSYN, 1460)
+	clampMSS(pkt, 1332)
+	if v := binary.BigEndian.Uint16(pkt[42:]); v != 1292 {
+		t.Errorf("MSS is %d, expected 1292", v)
+	}
+	if !validTCPChecksum(pkt) {
+		t.Error("invalid TCP checksum")
+	}
+
+	// MSS fits the MTU
+	pkt = tcpPacket(44, tcpFlagSYN, 1200)
+	clampMSS(pkt, 1332)
+	if v := binary.BigEndian.Uint16(pkt[42:]); v != 1200 {
+		t.Errorf("MSS is %d, expected 1200", v)
+	}
+
+	// not a SYN packet
+	pkt = tcpPacket(44, 0x10, 1460)
+	clampMSS(pkt, 1332)
+	if v := binary.BigEndian.Uint16(pkt[42:]); v != 1460 {
+		t.Errorf("MSS is %d, expected 1460", v)
+	}
+}
+
+func TestPacketTooBig(t *testing.T) {
+	buf := make([]byte, ipv6MinMTU)
+
+	if v := packetTooBig(tcpPacket(1332, 0x10, 0), 1332, buf); v != nil {
+		t.Error("unexpected reply to the packet, which fits the MTU")
+	}
+
+	pkt := tcpPacket(1400, 0x10, 0)
+	v := packetTooBig(pkt, 1332, buf)
+	if v == nil {
+		t.Fatal("expected ICMP reply")
+	}
+	if foldChecksum(checksum(v[:20], 0)) != 0 {
+		t.Error("invalid IP checksum")
+	}
+	icmp := v[20:]
+	if icmp[0] != icmpUnreachable || icmp[1] != icmpFragNeeded {
+		t.Errorf("unexpected ICMP type %d and code %d", icmp[0], icmp[1])
+	}
+	if mtu := binary.BigEndian.Uint16(icmp[6:]); mtu != 1332 {
+		t.Errorf("ICMP MTU is %d, expected 1332", mtu)
+	}
+	if foldChecksum(checksum(icmp, 0)) != 0 {
+		t.Error("invalid ICMP checksum")
+	}
+	if string(v[12:16]) != string(pkt[16:20]) || string(v[16:20]) != string(pkt[12:16]) {
+		t.Error("ICMP reply addresses are not swapped")
+	}
+
+	// the packet can be fragmented
+	pkt[6] = 0
+	if v := packetTooBig(pkt, 1332, buf); v != nil {
+		t.Error("unexpected reply to the packet without the DF flag")
+	}
+}
+
+func TestPathMTU(t *testing.T) {
+	for _, v := range []struct {
+		tun, negotiated, expected int
+	}{
+		{0, 1332, 1332},
+		{1500, 1332, 1332},
+		{1280, 1332, 1280},
+	} {
+		l := &vpnLink{tunMTU: v.tun, mtuInt: uint16(v.negotiated)}
+		if mtu := l.pathMTU(); mtu != v.expected {
+			t.Errorf("unexpected %d/%d path MTU: %d", v.tun, v.negotiated, mtu)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+//go:build linux
+// +build linux
+
+package link
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+)
+
+// the paths used by "ip netns"
+const (
+	netnsRunDir = "/var/run/netns"
+	netnsEtcDir = "/etc/netns"
+)
+
+func netnsPath(name string) string {
+	return filepath.Join(netnsRunDir, name)
+}
+
+// openNetns returns the named network namespace handle, the namespace is
+// created, when it doesn't exist
+func openNetns(name string) (netns.NsHandle, error) {
+	ns, err := netns.GetFromPath(netnsPath(name))
+	if err == nil {
+		return ns, nil
+	}
+	if !os.IsNotExist(err) {
+		return -1, fmt.Errorf("failed to open %q network namespace: %s", name, err)
+	}
+
+	if err = createNetns(name); err != nil {
+		return -1, err
+	}
+
+	ns, err = netns.GetFromPath(netnsPath(name))
+	if err != nil {
+		return -1, fmt.Errorf("failed to open %q network namespace: %s", name, err)
+	}
+
+	// loopback is down in a new namespace
+	h, err := netlink.NewHandleAt(ns)
+	if err != nil {
+		ns.Close()
+		return -1, fmt.Errorf("failed to open %q network namespace netlink: %s", name, err)
+	}
+	defer h.Delete()
+	lo, err := h.LinkByName("lo")
+	if err == nil {
+		err = h.LinkSetUp(lo)
+	}
+	if err != nil {
+		ns.Close()
+		return -1, fmt.Errorf("failed to set loopback up in %q network namespace: %s", name, err)
+	}
+
+	return ns, nil
+}
+
+// createNetns creates a persistent network namespace the same way as
+// "ip netns add" does, i.e. bind mounts it into the /var/run/netns
+func createNetns(name string) error {
+	if err := os.MkdirAll(netnsRunDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s directory: %s", netnsRunDir, err)
+	}
+
+	path := netnsPath(name)
+	f, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE|os.O_EXCL, 0444)
+	if err != nil {
+		return fmt.Errorf("failed to create %s mount point: %s", path, err)
+	}
+	f.Close()
+
+	// namespaces are bound to the OS thread
+	runtime.LockOSThread()
+	origin, err := netns.Get()
+	if err != nil {
+		runtime.UnlockOSThread()
+		os.Remove(path)
+		return fmt.Errorf("failed to get current network namespace: %s", err)
+	}
+	defer origin.Close()
+
+	err = unix.Unshare(unix.CLONE_NEWNET)
+	if err == nil {
+		err = unix.Mount(fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid()), path, "none", unix.MS_BIND, "")
+	}
+	// return to the original namespace, the thread stays locked and is
+	// terminated with the goroutine, when the namespace cannot be restored
+	if e := unix.Setns(int(origin), unix.CLONE_NEWNET); e != nil {
+		return fmt.Errorf("failed to restore current network namespace: %s", e)
+	}
+	runtime.UnlockOSThread()
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to create %q network namespace: %s", name, err)
+	}
+
+	return nil
+}
+
+// NewNetnsBackend returns the backend, which moves the TUN interface into
+// the named network namespace and configures routes and DNS inside of it,
+// the host routes and DNS settings are not changed
+func NewNetnsBackend(name string, queues int, offload bool) Backend {
+	return Backend{
+		OpenTun: func(local, gw *net.IPNet, ifname string, mtu int) (Device, error) {
+			return openNetnsTun(name, local, gw, ifname, mtu, queues, offload)
+		},
+		NewRouter: func(ifname string, routes []*net.IPNet, gw net.IP) (Router, error) {
+			return &netnsRouter{netns: name, name: ifname, routes: routes, gw: gw}, nil
+		},
+		NewResolver: func(_ string, servers []net.IP, suffixes []string, _ bool) (Resolver, error) {
+			return &netnsResolver{
+				path:     filepath.Join(netnsEtcDir, name, "resolv.conf"),
+				servers:  servers,
+				suffixes: suffixes,
+			}, nil
+		},
+	}
+}
+
+func openNetnsTun(name string, local, gw *net.IPNet, ifname string, mtu, queues int, offload bool) (Device, error) {
+	ns, err := openNetns(name)
+	if err != nil {
+		return nil, err
+	}
+	defer ns.Close()
+
+	t, err := newMQTun(ifname, queues, offload)
+	if err != nil {
+		return nil, err
+	}
+
+	link, err := netlink.LinkByName(t.name)
+	if err == nil {
+		err = netlink.LinkSetNsFd(link, int(ns))
+	}
+	if err != nil {
+		t.Close()
+		return nil, fmt.Errorf("failed to move %s interface into %q network namespace: %s", t.name, name, err)
+	}
+
+	h, err := netlink.NewHandleAt(ns)
+	if err != nil {
+		t.Close()
+		return nil, fmt.Errorf("failed to open %q network namespace netlink: %s", name, err)
+	}
+	defer h.Delete()
+
+	err = setTunInterface(h, t.name, local, gw, mtu)
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// netnsRouter sets routes inside the network namespace
+type netnsRouter struct {
+	netns  string
+	name   string
+	routes []*net.IPNet
+	gw     net.IP
+}
+
+func (r *netnsRouter) handle() (*netlink.Handle, netlink.Link, error) {
+	ns, err := netns.GetFromPath(netnsPath(r.netns))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open %q network namespace: %s", r.netns, err)
+	}
+	defer ns.Close()
+
+	h, err := netlink.NewHandleAt(ns)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open %q network namespace netlink: %s", r.netns, err)
+	}
+	link, err := h.LinkByName(r.name)
+	if err != nil {
+		h.Delete()
+		return nil, nil, fmt.Errorf("failed to detect %s interface: %s", r.name, err)
+	}
+	return h, link, nil
+}
+
+func (r *netnsRouter) Add() {
+	h, link, err := r.handle()
+	if err != nil {
+		routeLog.Error("Failed to add routes", "err", err)
+		return
+	}
+	defer h.Delete()
+
+	for _, dst := range r.routes {
+		err = h.RouteAdd(&netlink.Route{LinkIndex: link.Attrs().Index, Dst: dst, Gw: r.gw})
+		if err != nil {
+			routeLog.Error("Failed to add route", "route", dst, "err", err)
+		}
+	}
+}
+
+func (r *netnsRouter) Del() {
+	h, link, err := r.handle()
+	if err != nil {
+		// routes are removed together with the interface
+		routeLog.Debug("Skipping routes removal", "err", err)
+		return
+	}
+	defer h.Delete()
+
+	for _, dst := range r.routes {
+		err = h.RouteDel(&netlink.Route{LinkIndex: link.Attrs().Index, Dst: dst, Gw: r.gw})
+		if err != nil {
+			routeLog.Error("Failed to delete route", "route", dst, "err", err)
+		}
+	}
+}
+
+// netnsResolver writes the /etc/netns/<name>/resolv.conf, which is bind
+// mounted over the /etc/resolv.conf by "gof5 exec" and "ip netns exec"
+type netnsResolver struct {
+	path     string
+	servers  []net.IP
+	suffixes []string
+	// the original file content, nil when the file didn't exist
+	backup []byte
+}
+
+func (r *netnsResolver) Set() error {
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s directory: %s", filepath.Dir(r.path), err)
+	}
+
+	if raw, err := os.ReadFile(r.path); err == nil {
+		r.backup = raw
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("# created by gof5\n")
+	for _, v := range r.servers {
+		fmt.Fprintf(&buf, "nameserver %s\n", v)
+	}
+	if len(r.suffixes) > 0 {
+		fmt.Fprintf(&buf, "search %s\n", strings.Join(r.suffixes, " "))
+	}
+
+	if err := os.WriteFile(r.path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %s", r.path, err)
+	}
+	return nil
+}
+
+func (r *netnsResolver) Restore() {
+	var err error
+	if r.backup != nil {
+		err = os.WriteFile(r.path, r.backup, 0644)
+	} else {
+		err = os.Remove(r.path)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		dnsLog.Error("Failed to restore DNS settings", "path", r.path, "err", err)
+	}
+}
+
+func (r *netnsResolver) IsResolve() bool                { return false }
+func (r *netnsResolver) IsNetworkManager() bool         { return false }
+func (r *netnsResolver) IsShill() bool                  { return false }
+func (r *netnsResolver) GetOriginalDNS() []net.IP       { return nil }
+func (r *netnsResolver) GetOriginalSuffixes() []string  { return nil }
+func (r *netnsResolver) SetDNSServers(servers []net.IP) { r.servers = servers }
+func (r *netnsResolver) SetSuffixes(suffixes []string)  { r.suffixes = suffixes }
+func (r *netnsResolver) SetDNSDomains(domains []string) {}
+
+// ExecNetns executes the command inside the network namespace, the files from
+// the /etc/netns/<name> directory are bind mounted over the /etc files like
+// "ip netns exec" does. The function returns only on error.
+func ExecNetns(name string, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("command is required")
+	}
+
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return err
+	}
+
+	ns, err := netns.GetFromPath(netnsPath(name))
+	if err != nil {
+		return fmt.Errorf("failed to open %q network namespace: %s", name, err)
+	}
+	defer ns.Close()
+
+	// the thread is replaced by the command
+	runtime.LockOSThread()
+
+	// private mount namespace, the bind mounts are not visible on the host
+	if err = unix.Unshare(unix.CLONE_NEWNS); err != nil {
+		return fmt.Errorf("failed to create mount namespace: %s", err)
+	}
+	if err = unix.Mount("", "/", "none", unix.MS_SLAVE|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("failed to remount root: %s", err)
+	}
+	if err = unix.Setns(int(ns), unix.CLONE_NEWNET); err != nil {
+		return fmt.Errorf("failed to join %q network namespace: %s", name, err)
+	}
+
+	etcDir := filepath.Join(netnsEtcDir, name)
+	files, err := os.ReadDir(etcDir)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s directory: %s", etcDir, err)
+	}
+	for _, f := range files {
+		src := filepath.Join(etcDir, f.Name())
+		dst := filepath.Join("/etc", f.Name())
+		if err = unix.Mount(src, dst, "none", unix.MS_BIND, ""); err != nil {
+			slog.Warn("Failed to bind namespace config", "src", src, "dst", dst, "err", err)
+		}
+	}
+
+	return unix.Exec(path, args, os.Environ())
+}
@@ -0,0 +1,118 @@
+//go:build linux
+// +build linux
+
+package link
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+)
+
+func TestNetnsBackend(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root")
+	}
+
+	name := fmt.Sprintf("gof5-test-%d", os.Getpid())
+	defer func() {
+		unix.Unmount(netnsPath(name), unix.MNT_DETACH)
+		os.Remove(netnsPath(name))
+	}()
+
+	b := NewNetnsBackend(name, 1, false)
+	local := &net.IPNet{IP: net.IPv4(172, 16, 0, 2), Mask: net.CIDRMask(32, 32)}
+	gw := &net.IPNet{IP: net.IPv4(172, 16, 0, 1), Mask: net.CIDRMask(32, 32)}
+	dev, err := b.OpenTun(local, gw, "", 1332)
+	if err != nil {
+		t.Skipf("cannot create TUN: %s", err)
+	}
+	defer dev.Close()
+	ifname, _ := dev.Name()
+
+	if _, err := netlink.LinkByName(ifname); err == nil {
+		t.Errorf("%s interface is left in the host namespace", ifname)
+	}
+
+	_, dst, _ := net.ParseCIDR("10.11.0.0/16")
+	r, err := b.NewRouter(ifname, []*net.IPNet{dst}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Add()
+
+	ns, err := netns.GetFromPath(netnsPath(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ns.Close()
+	h, err := netlink.NewHandleAt(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Delete()
+
+	link, err := h.LinkByName(ifname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mtu := link.Attrs().MTU; mtu != 1332 {
+		t.Errorf("unexpected MTU %d", mtu)
+	}
+	routes, err := h.RouteListFiltered(netlink.FAMILY_V4, &netlink.Route{Dst: dst}, netlink.RT_FILTER_DST)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 1 || routes[0].LinkIndex != link.Attrs().Index {
+		t.Errorf("route is not set in the namespace: %v", routes)
+	}
+
+	r.Del()
+	routes, _ = h.RouteListFiltered(netlink.FAMILY_V4, &netlink.Route{Dst: dst}, netlink.RT_FILTER_DST)
+	if len(routes) != 0 {
+		t.Errorf("route is not removed: %v", routes)
+	}
+}
+
+func TestNetnsResolver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "corp", "resolv.conf")
+	r := &netnsResolver{
+		path:     path,
+		servers:  []net.IP{net.IPv4(10, 0, 0, 53)},
+		suffixes: []string{"corp.example", "example"},
+	}
+	if err := r.Set(); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "# created by gof5\nnameserver 10.0.0.53\nsearch corp.example example\n"
+	if string(raw) != expected {
+		t.Errorf("unexpected resolv.conf:\n%s", raw)
+	}
+
+	r.Restore()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("resolv.conf is not removed: %v", err)
+	}
+
+	// the existing file is restored
+	if err := os.WriteFile(path, []byte("nameserver 1.1.1.1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Set(); err != nil {
+		t.Fatal(err)
+	}
+	r.Restore()
+	if raw, _ := os.ReadFile(path); string(raw) != "nameserver 1.1.1.1\n" {
+		t.Errorf("resolv.conf is not restored:\n%s", raw)
+	}
+}
@@ -0,0 +1,28 @@
+//go:build !linux
+// +build !linux
+
+package link
+
+import (
+	"fmt"
+	"net"
+)
+
+func NewNetnsBackend(_ string, _ int, _ bool) Backend {
+	err := fmt.Errorf("network namespaces are supported only in Linux")
+	return Backend{
+		OpenTun: func(_, _ *net.IPNet, _ string, _ int) (Device, error) {
+			return nil, err
+		},
+		NewRouter: func(_ string, _ []*net.IPNet, _ net.IP) (Router, error) {
+			return nil, err
+		},
+		NewResolver: func(_ string, _ []net.IP, _ []string, _ bool) (Resolver, error) {
+			return nil, err
+		},
+	}
+}
+
+func ExecNetns(_ string, _ []string) error {
+	return fmt.Errorf("network namespaces are supported only in Linux")
+}
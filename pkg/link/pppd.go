@@ -6,14 +6,13 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
-	"log"
 	"os/exec"
 	"strings"
 	"syscall"
 
+	"github.com/kayrus/gof5/pkg/metrics"
 	"github.com/kayrus/gof5/pkg/util"
 
-	"github.com/fatih/color"
 	"github.com/hpcloud/tail"
 	"github.com/zaninime/go-hdlc"
 	"golang.org/x/net/ipv4"
@@ -26,52 +25,53 @@ func (l *vpnLink) decodeHDLC(buf []byte, src string) {
 	tmp := bytes.NewBuffer(buf)
 	frame, err := hdlc.NewDecoder(tmp).ReadFrame()
 	if err != nil {
-		log.Printf("fatal decode HDLC frame from %s: %s", src, err)
+		pppLog.Debug("Failed to decode HDLC frame", "source", src, "err", err)
 		return
 		/*
-			l.ErrChan <- fmt.Errorf("fatal decode HDLC frame from %s: %s", source, err)
+			l.sendErr(fmt.Errorf("fatal decode HDLC frame from %s: %s", source, err))
 			return
 		*/
 	}
-	log.Printf("Decoded %t prefix HDLC frame from %s:\n%s", frame.HasAddressCtrlPrefix, src, hex.Dump(frame.Payload))
+	pppLog.Debug("Decoded HDLC frame", "source", src, "prefix", frame.HasAddressCtrlPrefix, "dump", hex.Dump(frame.Payload))
 	h, err := ipv4.ParseHeader(frame.Payload[:])
 	if err != nil {
-		log.Printf("fatal to parse TCP header from %s: %s", src, err)
+		pppLog.Debug("Failed to parse IP header", "source", src, "err", err)
 		return
 		/*
-			l.ErrChan <- fmt.Errorf("fatal to parse TCP header: %s", err)
+			l.sendErr(fmt.Errorf("fatal to parse TCP header: %s", err))
 			return
 		*/
 	}
-	log.Printf("TCP: %s", h)
+	pppLog.Debug("Decoded IP header", "source", src, "header", h)
 }
 
 // http->tun
 func (l *vpnLink) PppdHTTPToTun(pppd io.WriteCloser) {
-	buf := make([]byte, bufferSize)
+	buf := make([]byte, l.bufferSize)
 	for {
 		select {
 		case <-l.TunDown:
 			return
 		default:
-			rn, err := l.HTTPConn.Read(buf)
+			rn, err := l.reader.Read(buf)
 			if err != nil {
 				if err != io.EOF {
-					l.ErrChan <- fmt.Errorf("fatal read http: %s", err)
+					l.sendErr(fmt.Errorf("fatal read http: %s", err))
 				}
 				return
 			}
 			if l.debug {
 				l.decodeHDLC(buf[:rn], "http")
-				log.Printf("Read %d bytes from http:\n%s", rn, hex.Dump(buf[:rn]))
+				pppLog.Debug("Read bytes from http", "bytes", rn, "dump", hex.Dump(buf[:rn]))
 			}
 			wn, err := pppd.Write(buf[:rn])
 			if err != nil {
-				l.ErrChan <- fmt.Errorf("fatal write to pppd: %s", err)
+				l.sendErr(fmt.Errorf("fatal write to pppd: %s", err))
 				return
 			}
+			metrics.AddBytes(metrics.In, wn)
 			if l.debug {
-				log.Printf("Sent %d bytes to pppd", wn)
+				pppLog.Debug("Sent bytes to pppd", "bytes", wn)
 			}
 		}
 	}
@@ -79,7 +79,7 @@ func (l *vpnLink) PppdHTTPToTun(pppd io.WriteCloser) {
 
 // tun->http
 func (l *vpnLink) PppdTunToHTTP(pppd io.ReadCloser) {
-	buf := make([]byte, bufferSize)
+	buf := make([]byte, l.bufferSize)
 	for {
 		select {
 		case <-l.TunDown:
@@ -88,21 +88,22 @@ func (l *vpnLink) PppdTunToHTTP(pppd io.ReadCloser) {
 			rn, err := pppd.Read(buf)
 			if err != nil {
 				if err != io.EOF {
-					l.ErrChan <- fmt.Errorf("fatal read pppd: %s", err)
+					l.sendErr(fmt.Errorf("fatal read pppd: %s", err))
 				}
 				return
 			}
 			if l.debug {
-				log.Printf("Read %d bytes from pppd:\n%s", rn, hex.Dump(buf[:rn]))
+				pppLog.Debug("Read bytes from pppd", "bytes", rn, "dump", hex.Dump(buf[:rn]))
 				l.decodeHDLC(buf[:rn], "pppd")
 			}
 			wn, err := l.HTTPConn.Write(buf[:rn])
 			if err != nil {
-				l.ErrChan <- fmt.Errorf("fatal write to http: %s", err)
+				l.sendErr(fmt.Errorf("fatal write to http: %s", err))
 				return
 			}
+			metrics.AddBytes(metrics.Out, wn)
 			if l.debug {
-				log.Printf("Sent %d bytes to http", wn)
+				pppLog.Debug("Sent bytes to http", "bytes", wn)
 			}
 		}
 	}
@@ -138,7 +139,7 @@ func (l *vpnLink) PppdLogParser(stderr io.Reader) {
 		if strings.Contains(str, "remote IP address") {
 			close(l.pppUp)
 		}
-		colorlog.Print(color.HiGreenString(str))
+		pppLog.Info(str)
 	}
 }
 
@@ -152,7 +153,7 @@ func (l *vpnLink) PppLogParser() {
 		Logger:   tail.DiscardingLogger,
 	})
 	if err != nil {
-		l.ErrChan <- fmt.Errorf("failed to read ppp log: %s", err)
+		l.sendErr(fmt.Errorf("failed to read ppp log: %s", err))
 		return
 	}
 	for line := range t.Lines {
@@ -169,6 +170,6 @@ func (l *vpnLink) PppLogParser() {
 		if strings.Contains(str, "IPCP: myaddr") {
 			close(l.pppUp)
 		}
-		colorlog.Print(color.HiGreenString(str))
+		pppLog.Info(str)
 	}
 }
@@ -0,0 +1,201 @@
+package link
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+
+	"github.com/kayrus/gof5/pkg/config"
+	"github.com/kayrus/gof5/pkg/dns"
+	"github.com/kayrus/gof5/pkg/journal"
+)
+
+// Reload applies the routes and DNS changes of the reloaded config without
+// reestablishing the tunnel, cfg is updated with the applied values
+func (l *vpnLink) Reload(cfg, newCfg *config.Config) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if cfg.Script != "" {
+		return fmt.Errorf("reload is not supported, when routes and DNS are managed by the %q script", cfg.Script)
+	}
+
+	if l.routeHandler == nil {
+		return fmt.Errorf("tunnel is not configured yet")
+	}
+
+	warnReconnect(cfg, newCfg)
+
+	if err := l.reloadRoutes(cfg, newCfg); err != nil {
+		return err
+	}
+
+	return l.reloadDNS(cfg, newCfg)
+}
+
+// warnReconnect logs the changed settings, which cannot be applied without
+// reestablishing the tunnel
+func warnReconnect(cfg, newCfg *config.Config) {
+	changed := func(name string, v bool) {
+		if v {
+			slog.Warn("Setting change requires a reconnect, skipping", "setting", name)
+		}
+	}
+	changed("server", cfg.Server != newCfg.Server)
+	changed("driver", cfg.Driver != newCfg.Driver)
+	changed("dtls", cfg.DTLS != newCfg.DTLS)
+	changed("ipv6", cfg.IPv6 != newCfg.IPv6)
+	changed("listenDNS", !cfg.ListenDNS.Equal(newCfg.ListenDNS))
+	changed("disableDNS", cfg.DisableDNS != newCfg.DisableDNS)
+	changed("rewriteResolv", cfg.RewriteResolv != newCfg.RewriteResolv)
+	changed("overrideDNS", !ipsEqual(cfg.OverrideDNS, newCfg.OverrideDNS))
+	changed("dnsLeakProtection", cfg.DNSLeakProtection != newCfg.DNSLeakProtection)
+	changed("killSwitch", cfg.KillSwitch != newCfg.KillSwitch)
+	changed("killSwitchAllowLAN", cfg.KillSwitchAllowLAN != newCfg.KillSwitchAllowLAN)
+	// switching between the DNS proxy and the VPN DNS servers
+	changed("dns", len(cfg.DNS) == 0 != (len(newCfg.DNS) == 0))
+	// the F5 pushed DNS suffixes are lost after the override
+	changed("overrideDNSSuffix", len(cfg.OverrideDNSSuffix) > 0 && len(newCfg.OverrideDNSSuffix) == 0)
+}
+
+func (l *vpnLink) reloadRoutes(cfg, newCfg *config.Config) error {
+	cfg.Routes = newCfg.Routes
+	cfg.Routes6 = newCfg.Routes6
+	cfg.RoutesMode = newCfg.RoutesMode
+	cfg.RouteHosts = newCfg.RouteHosts
+	cfg.ExcludeRoutes = newCfg.ExcludeRoutes
+	cfg.ExcludeRoutes6 = newCfg.ExcludeRoutes6
+	cfg.ExcludeRouteHosts = newCfg.ExcludeRouteHosts
+	l.startHostsWatcher(cfg)
+	return l.updateRoutes(cfg)
+}
+
+// updateRoutes applies the difference between the applied and the current
+// routes
+func (l *vpnLink) updateRoutes(cfg *config.Config) error {
+	routes, err := l.checkConflicts(cfg, l.buildRoutes(cfg))
+	if err != nil {
+		return err
+	}
+
+	add := subtractNets(routes, l.routes)
+	del := subtractNets(l.routes, routes)
+	if len(add) == 0 && len(del) == 0 {
+		return nil
+	}
+
+	if len(add) > 0 {
+		routeLog.Info("Adding routes", "interface", l.name, "routes", add)
+		// persist the added routes before they are applied
+		if err := journal.Record(cfg.Path, journal.RouteEntry(l.name, add, l.gw, cfg.RouteTable)); err != nil {
+			return err
+		}
+		h, err := l.Backend.NewRouter(l.name, add, l.gw)
+		if err != nil {
+			return err
+		}
+		h.Add()
+	}
+
+	if len(del) > 0 {
+		routeLog.Info("Removing routes", "interface", l.name, "routes", del)
+		h, err := l.Backend.NewRouter(l.name, del, l.gw)
+		if err != nil {
+			return err
+		}
+		h.Del()
+	}
+
+	h, err := l.Backend.NewRouter(l.name, routes, l.gw)
+	if err != nil {
+		return err
+	}
+	l.routeHandler = h
+	l.routes = routes
+
+	// replace the journal entries with the resulting routes
+	if err = journal.Forget(cfg.Path, journal.Route, l.name); err != nil {
+		return err
+	}
+	return journal.Record(cfg.Path, journal.RouteEntry(l.name, routes, l.gw, cfg.RouteTable))
+}
+
+func (l *vpnLink) reloadDNS(cfg, newCfg *config.Config) error {
+	if len(cfg.DNS) == 0 != (len(newCfg.DNS) == 0) {
+		// requires a reconnect
+		return nil
+	}
+
+	suffixesChanged := len(newCfg.OverrideDNSSuffix) > 0 && !strsEqual(cfg.OverrideDNSSuffix, newCfg.OverrideDNSSuffix)
+	if strsEqual(cfg.DNS, newCfg.DNS) && !suffixesChanged {
+		return nil
+	}
+
+	cfg.DNS = newCfg.DNS
+	if suffixesChanged {
+		cfg.OverrideDNSSuffix = newCfg.OverrideDNSSuffix
+		cfg.F5Config.Object.DNSSuffix = newCfg.OverrideDNSSuffix
+	}
+
+	if cfg.DisableDNS {
+		return nil
+	}
+
+	dnsLog.Info("Updating DNS settings")
+	if len(cfg.DNS) > 0 {
+		dnsLog.Info("Forwarding DNS requests", "zones", cfg.DNS, "servers", cfg.F5Config.Object.DNS)
+		dns.SetZones(cfg.DNS)
+	}
+
+	l.resolvHandler.SetSuffixes(l.dnsSuffixes(cfg))
+	if l.resolvHandler.IsResolve() {
+		l.resolvHandler.SetDNSDomains(dnsDomains(cfg))
+	}
+
+	if !l.resolvHandler.IsResolve() && !l.resolvHandler.IsNetworkManager() && !l.resolvHandler.IsShill() && !cfg.RewriteResolv {
+		// the renamed /etc/resolv.conf backup must be restored first,
+		// otherwise it is overwritten by the next rename
+		l.resolvHandler.Restore()
+	}
+
+	return l.resolvHandler.Set()
+}
+
+// subtractNets returns the networks from a, which are missing in b
+func subtractNets(a, b []*net.IPNet) []*net.IPNet {
+	m := make(map[string]bool, len(b))
+	for _, v := range b {
+		m[v.String()] = true
+	}
+	var res []*net.IPNet
+	for _, v := range a {
+		if !m[v.String()] {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+func strsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func ipsEqual(a, b []net.IP) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
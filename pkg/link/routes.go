@@ -0,0 +1,165 @@
+package link
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/kayrus/gof5/pkg/config"
+
+	"github.com/IBM/netaddr"
+)
+
+// route conflict policies
+const (
+	warnOnly    = "warn"
+	preferVPN   = "prefer-vpn"
+	preferLocal = "prefer-local"
+	failOnLocal = "fail"
+)
+
+// localNetworks returns the connected subnets and the host routes, except
+// the default routes and the routes via the excluded interface
+func localNetworks(exclude string) ([]*net.IPNet, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list interfaces: %s", err)
+	}
+
+	var res []*net.IPNet
+	for _, iface := range ifaces {
+		if iface.Name == exclude || iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s interface addresses: %s", iface.Name, err)
+		}
+		for _, addr := range addrs {
+			if v, ok := addr.(*net.IPNet); ok && !v.IP.IsLinkLocalUnicast() {
+				res = append(res, &net.IPNet{IP: v.IP.Mask(v.Mask), Mask: v.Mask})
+			}
+		}
+	}
+
+	routes, err := hostRoutes(exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	// connected subnets are usually listed in the routing table as well
+	seen := make(map[string]bool)
+	var uniq []*net.IPNet
+	for _, v := range append(res, routes...) {
+		if !seen[v.String()] {
+			seen[v.String()] = true
+			uniq = append(uniq, v)
+		}
+	}
+	return uniq, nil
+}
+
+func overlaps(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// resolveConflicts detects the VPN routes, which overlap the local networks,
+// and resolves them according to the policy
+func resolveConflicts(routes, local []*net.IPNet, policy string) ([]*net.IPNet, error) {
+	var conflicts []*net.IPNet
+	seen := make(map[string]bool)
+	for _, r := range routes {
+		seen[r.String()] = true
+		for _, n := range local {
+			if overlaps(r, n) {
+				routeLog.Warn("VPN route overlaps local network", "route", r, "local", n, "policy", policy)
+				if !seen[n.String()] {
+					seen[n.String()] = true
+					conflicts = append(conflicts, n)
+				}
+			}
+		}
+	}
+	if len(conflicts) == 0 {
+		return routes, nil
+	}
+
+	switch policy {
+	case failOnLocal:
+		return nil, fmt.Errorf("VPN routes overlap local networks: %s", conflicts)
+	case warnOnly:
+		// the longest prefix wins, the more specific local routes are still
+		// used
+		return routes, nil
+	case preferLocal:
+		// the source routes set must not be changed
+		set := &netaddr.IPSet{}
+		for _, r := range routes {
+			set.InsertNet(r)
+		}
+		for _, n := range conflicts {
+			set.RemoveNet(n)
+		}
+		return set.GetNetworks(), nil
+	}
+
+	// the longest prefix wins, so the VPN covered parts of the local networks
+	// are added as more specific routes, e.g. 10.0.0.0/25 and 10.0.0.128/25
+	// for the local 10.0.0.0/24 and the VPN 10.0.0.0/8
+	set := &netaddr.IPSet{}
+	for _, r := range routes {
+		set.InsertNet(r)
+	}
+	res := append([]*net.IPNet(nil), routes...)
+	for _, n := range conflicts {
+		localSet := &netaddr.IPSet{}
+		localSet.InsertNet(n)
+		localOnes, _ := n.Mask.Size()
+		for _, v := range set.Intersection(localSet).GetNetworks() {
+			more := []*net.IPNet{v}
+			if ones, bits := v.Mask.Size(); ones == bits {
+				if ones == localOnes {
+					routeLog.Warn("Cannot override local host route", "local", n)
+					continue
+				}
+			} else if ones == localOnes {
+				more = splitNet(v)
+			}
+			for _, m := range more {
+				if !seen[m.String()] {
+					seen[m.String()] = true
+					res = append(res, m)
+				}
+			}
+		}
+	}
+	return res, nil
+}
+
+// splitNet splits the network into two halves
+func splitNet(n *net.IPNet) []*net.IPNet {
+	ones, bits := n.Mask.Size()
+	mask := net.CIDRMask(ones+1, bits)
+	lo := n.IP.Mask(n.Mask)
+	hi := append(net.IP(nil), lo...)
+	hi[ones/8] |= 0x80 >> (ones % 8)
+	return []*net.IPNet{{IP: lo, Mask: mask}, {IP: hi, Mask: mask}}
+}
+
+// checkConflicts resolves the VPN routes conflicts with the local networks,
+// the check is skipped, when the backend cannot detect local networks
+func (l *vpnLink) checkConflicts(cfg *config.Config, routes []*net.IPNet) ([]*net.IPNet, error) {
+	if l.Backend.LocalNetworks == nil {
+		return routes, nil
+	}
+
+	local, err := l.Backend.LocalNetworks(l.name)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := cfg.RouteConflict
+	if policy == "" {
+		policy = warnOnly
+	}
+	return resolveConflicts(routes, local, policy)
+}
@@ -0,0 +1,37 @@
+//go:build linux
+// +build linux
+
+package link
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/vishvananda/netlink"
+)
+
+// hostRoutes returns the main table routes, except the default routes and
+// the routes via the loopback and the excluded interfaces
+func hostRoutes(exclude string) ([]*net.IPNet, error) {
+	routes, err := netlink.RouteList(nil, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list routes: %s", err)
+	}
+
+	var res []*net.IPNet
+	for _, r := range routes {
+		if r.Dst == nil || r.Dst.IP.IsUnspecified() || r.Dst.IP.IsLinkLocalUnicast() || r.Dst.IP.IsMulticast() {
+			continue
+		}
+		if ones, _ := r.Dst.Mask.Size(); ones == 0 {
+			continue
+		}
+		if link, err := netlink.LinkByIndex(r.LinkIndex); err == nil {
+			if attrs := link.Attrs(); attrs.Name == exclude || attrs.Flags&net.FlagLoopback != 0 {
+				continue
+			}
+		}
+		res = append(res, r.Dst)
+	}
+	return res, nil
+}
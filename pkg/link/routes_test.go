@@ -0,0 +1,131 @@
+package link
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/IBM/netaddr"
+)
+
+func cidrs(v ...string) []*net.IPNet {
+	var res []*net.IPNet
+	for _, s := range v {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			panic(err)
+		}
+		res = append(res, n)
+	}
+	return res
+}
+
+func TestResolveConflicts(t *testing.T) {
+	routes := cidrs("10.0.0.0/8", "192.168.100.0/24")
+	local := cidrs("10.1.0.0/24", "192.168.1.0/24", "fd00::/64")
+
+	v, err := resolveConflicts(routes, local, warnOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := fmt.Sprint(v); s != "[10.0.0.0/8 192.168.100.0/24]" {
+		t.Errorf("unexpected routes: %s", s)
+	}
+
+	v, err = resolveConflicts(routes, local, preferVPN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the local network is overridden by the more specific VPN routes
+	if s := fmt.Sprint(v); s != "[10.0.0.0/8 192.168.100.0/24 10.1.0.0/25 10.1.0.128/25]" {
+		t.Errorf("unexpected routes: %s", s)
+	}
+
+	// the excluded addresses stay outside of the VPN, the local network
+	// bigger than the VPN route is not split
+	excluded := cidrs("10.0.0.0/25", "10.0.0.128/26", "10.0.0.192/27", "10.0.0.224/28", "10.0.0.240/29", "10.0.0.248/30", "10.0.0.252/31", "10.0.0.255/32", "172.16.1.0/24")
+	v, err = resolveConflicts(excluded, cidrs("10.0.0.0/24", "172.16.0.0/16", "10.0.0.254/32"), preferVPN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v) != len(excluded) {
+		t.Errorf("unexpected routes: %s", v)
+	}
+
+	v, err = resolveConflicts(routes, local, preferLocal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range v {
+		if overlaps(n, local[0]) {
+			t.Errorf("%s route overlaps local %s network", n, local[0])
+		}
+	}
+	for _, ip := range []string{"10.0.0.1", "10.1.1.1", "10.255.0.1", "192.168.100.1"} {
+		found := false
+		for _, n := range v {
+			found = found || n.Contains(net.ParseIP(ip))
+		}
+		if !found {
+			t.Errorf("%s is not routed: %s", ip, v)
+		}
+	}
+	// the source routes are not changed
+	if routes[0].String() != "10.0.0.0/8" {
+		t.Errorf("source routes were modified: %s", routes)
+	}
+
+	if _, err = resolveConflicts(routes, local, failOnLocal); err == nil {
+		t.Error("expected conflict error")
+	}
+
+	// no conflicts
+	if _, err = resolveConflicts(routes, cidrs("172.16.0.0/12"), failOnLocal); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBuildRoutesMode(t *testing.T) {
+	l, cfg := newTestLink(t, nil)
+	cfg.F5Config.Object.Routes = &netaddr.IPSet{}
+	for _, v := range cidrs("10.0.0.0/8", "172.16.0.0/12") {
+		cfg.F5Config.Object.Routes.InsertNet(v)
+	}
+	cfg.Routes = &netaddr.IPSet{}
+	cfg.Routes.InsertNet(cidrs("10.1.0.0/16")[0])
+	cfg.RouteHosts = []string{"git.corp.example"}
+	l.resolved = map[string][]net.IP{
+		"git.corp.example": {net.IPv4(192, 168, 1, 1)},
+	}
+
+	for mode, expected := range map[string][]string{
+		"":         {"10.1.0.0/16", "192.168.1.1/32"},
+		"replace":  {"10.1.0.0/16", "192.168.1.1/32"},
+		"append":   {"10.0.0.0/8", "172.16.0.0/12", "192.168.1.1/32"},
+		"subtract": {"10.0.0.0/16", "10.2.0.0/15", "10.4.0.0/14", "10.8.0.0/13", "10.16.0.0/12", "10.32.0.0/11", "10.64.0.0/10", "10.128.0.0/9", "172.16.0.0/12"},
+	} {
+		cfg.RoutesMode = mode
+		var v []string
+		for _, n := range l.buildRoutes(cfg) {
+			v = append(v, n.String())
+		}
+		sort.Strings(v)
+		sort.Strings(expected)
+		if strings.Join(v, " ") != strings.Join(expected, " ") {
+			t.Errorf("unexpected %q mode routes: %s", mode, v)
+		}
+	}
+
+	// the F5 IPv6 routes require the ipv6 option
+	cfg.RoutesMode = "append"
+	cfg.F5Config.Object.Routes6 = &netaddr.IPSet{}
+	cfg.F5Config.Object.Routes6.InsertNet(cidrs("2001:db8::/32")[0])
+	for ipv6, n := range map[bool]int{false: 3, true: 4} {
+		cfg.IPv6 = ipv6
+		if v := l.buildRoutes(cfg); len(v) != n {
+			t.Errorf("unexpected routes with ipv6=%t: %s", ipv6, v)
+		}
+	}
+}
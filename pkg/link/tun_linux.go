@@ -0,0 +1,187 @@
+//go:build linux
+// +build linux
+
+package link
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+const cloneDevicePath = "/dev/net/tun"
+
+// mqTun is a multi-queue TUN device with the optional TCP segmentation
+// offload, every queue is served by its own goroutine
+type mqTun struct {
+	name    string
+	files   []*os.File
+	queues  []io.Reader
+	offload bool
+	// the virtio-net header is prepended to the written packets
+	wmu  sync.Mutex
+	wbuf []byte
+	once sync.Once
+}
+
+func openQueue(name string, flags uint16, offload bool) (*os.File, string, error) {
+	fd, err := unix.Open(cloneDevicePath, unix.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open %s: %s", cloneDevicePath, err)
+	}
+
+	ifr, err := unix.NewIfreq(name)
+	if err != nil {
+		unix.Close(fd)
+		return nil, "", err
+	}
+	ifr.SetUint16(flags)
+	if err = unix.IoctlIfreq(fd, unix.TUNSETIFF, ifr); err != nil {
+		unix.Close(fd)
+		return nil, "", fmt.Errorf("failed to create %q TUN queue: %s", name, err)
+	}
+
+	if offload {
+		err = unix.IoctlSetInt(fd, unix.TUNSETOFFLOAD, unix.TUN_F_CSUM|unix.TUN_F_TSO4|unix.TUN_F_TSO6)
+		if err != nil {
+			unix.Close(fd)
+			return nil, "", fmt.Errorf("failed to enable TUN offloads: %s", err)
+		}
+	}
+
+	// non-blocking descriptor is handled by the Go netpoller, Close
+	// interrupts the pending reads
+	if err = unix.SetNonblock(fd, true); err != nil {
+		unix.Close(fd)
+		return nil, "", err
+	}
+
+	return os.NewFile(uintptr(fd), cloneDevicePath), ifr.Name(), nil
+}
+
+func openMultiQueueTun(local, gw *net.IPNet, name string, mtu, queues int, offload bool) (Device, error) {
+	t, err := newMQTun(name, queues, offload)
+	if err != nil {
+		return nil, err
+	}
+
+	err = setTunInterface(&netlink.Handle{}, t.name, local, gw, mtu)
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// newMQTun creates the TUN device queues, the interface is not configured
+func newMQTun(name string, queues int, offload bool) (*mqTun, error) {
+	if queues < 1 {
+		queues = 1
+	}
+
+	flags := uint16(unix.IFF_TUN | unix.IFF_NO_PI | unix.IFF_MULTI_QUEUE)
+	if offload {
+		flags |= unix.IFF_VNET_HDR
+	}
+
+	t := &mqTun{
+		name:    name,
+		offload: offload,
+	}
+	for i := 0; i < queues; i++ {
+		f, ifname, err := openQueue(t.name, flags, offload)
+		if err != nil {
+			t.Close()
+			return nil, err
+		}
+		t.name = ifname
+		t.files = append(t.files, f)
+		if offload {
+			t.queues = append(t.queues, newGSOReader(f))
+		} else {
+			t.queues = append(t.queues, f)
+		}
+	}
+	if offload {
+		t.wbuf = make([]byte, virtioNetHdrLen+maxGSOSize)
+	}
+
+	return t, nil
+}
+
+// setTunInterface configures the interface in the handle network namespace
+func setTunInterface(h *netlink.Handle, name string, local, gw *net.IPNet, mtu int) error {
+	link, err := h.LinkByName(name)
+	if err != nil {
+		return fmt.Errorf("failed to detect %s interface: %s", name, err)
+	}
+
+	err = h.LinkSetMTU(link, mtu)
+	if err != nil {
+		return fmt.Errorf("failed to set %s interface MTU: %s", name, err)
+	}
+
+	err = h.AddrAdd(link, &netlink.Addr{
+		IPNet: local,
+		Peer:  gw,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set peer address on %s interface: %s", name, err)
+	}
+
+	err = h.LinkSetUp(link)
+	if err != nil {
+		return fmt.Errorf("failed to set %s interface up: %s", name, err)
+	}
+
+	return nil
+}
+
+// Read reads a packet from the first queue
+func (t *mqTun) Read(b []byte) (int, error) {
+	return t.queues[0].Read(b)
+}
+
+// Write writes a packet into the first queue
+func (t *mqTun) Write(b []byte) (int, error) {
+	if !t.offload {
+		return t.files[0].Write(b)
+	}
+
+	t.wmu.Lock()
+	defer t.wmu.Unlock()
+	// zero header, i.e. no GSO and the checksum is valid
+	buf := t.wbuf[:virtioNetHdrLen]
+	clear(buf)
+	buf = append(buf, b...)
+	n, err := t.files[0].Write(buf)
+	return max(n-virtioNetHdrLen, 0), err
+}
+
+// Queues returns the readers of the device queues
+func (t *mqTun) Queues() []io.Reader {
+	return t.queues
+}
+
+func (t *mqTun) Name() (string, error) {
+	return t.name, nil
+}
+
+func (t *mqTun) Close() error {
+	var err error
+	t.once.Do(func() {
+		// the interface is destroyed, when the last queue is closed
+		for _, f := range t.files {
+			if e := f.Close(); e != nil {
+				err = e
+			}
+		}
+	})
+	return err
+}
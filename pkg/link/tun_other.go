@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package link
+
+import (
+	"fmt"
+	"net"
+)
+
+func openMultiQueueTun(_, _ *net.IPNet, _ string, _, _ int, _ bool) (Device, error) {
+	return nil, fmt.Errorf("multi-queue TUN is supported only in Linux")
+}
@@ -0,0 +1,181 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// subsystems with individual log levels
+const (
+	HTTP  = "http"
+	PPP   = "ppp"
+	DNS   = "dns"
+	Route = "route"
+)
+
+var (
+	// the default level is stored under the empty name
+	levels = map[string]*slog.LevelVar{
+		"":    new(slog.LevelVar),
+		HTTP:  new(slog.LevelVar),
+		PPP:   new(slog.LevelVar),
+		DNS:   new(slog.LevelVar),
+		Route: new(slog.LevelVar),
+	}
+	formats = []string{"text", "json"}
+	base    atomic.Pointer[slog.Handler]
+)
+
+func init() {
+	if err := Setup(os.Stderr, "", "", false); err != nil {
+		panic(err)
+	}
+}
+
+// ParseLevels parses the "level,subsystem=level" specification, e.g.
+// "info,http=debug,dns=warn"
+func ParseLevels(spec string, debug bool) (map[string]slog.Level, error) {
+	def := slog.LevelInfo
+	if debug {
+		def = slog.LevelDebug
+	}
+
+	explicit := make(map[string]slog.Level)
+	for _, v := range strings.Split(spec, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		name, level := "", v
+		if i := strings.Index(v, "="); i >= 0 {
+			name, level = v[:i], v[i+1:]
+			if _, ok := levels[name]; !ok || name == "" {
+				return nil, fmt.Errorf("unknown %q log subsystem, supported subsystems are: %q", name, subsystems())
+			}
+		}
+		var l slog.Level
+		if err := l.UnmarshalText([]byte(level)); err != nil {
+			return nil, fmt.Errorf("invalid %q log level", level)
+		}
+		if name == "" {
+			def = l
+			continue
+		}
+		explicit[name] = l
+	}
+
+	// the default level applies to subsystems, which are not set explicitly
+	res := make(map[string]slog.Level, len(levels))
+	for name := range levels {
+		res[name] = def
+		if v, ok := explicit[name]; ok {
+			res[name] = v
+		}
+	}
+
+	return res, nil
+}
+
+func subsystems() []string {
+	var v []string
+	for name := range levels {
+		if name != "" {
+			v = append(v, name)
+		}
+	}
+	sort.Strings(v)
+	return v
+}
+
+// CheckFormat validates the log format
+func CheckFormat(format string) error {
+	if format == "" {
+		return nil
+	}
+	for _, v := range formats {
+		if v == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported %q log format, supported formats are: %q", format, formats)
+}
+
+// Setup configures the log format and levels, the standard log package output
+// is redirected to the default subsystem
+func Setup(w io.Writer, format, spec string, debug bool) error {
+	if err := CheckFormat(format); err != nil {
+		return err
+	}
+	l, err := ParseLevels(spec, debug)
+	if err != nil {
+		return err
+	}
+
+	// levels are filtered by subsystem handlers
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	var h slog.Handler
+	if format == "json" {
+		h = slog.NewJSONHandler(w, opts)
+	} else {
+		h = slog.NewTextHandler(w, opts)
+	}
+	h = &redactHandler{inner: h}
+	base.Store(&h)
+
+	for name, v := range l {
+		levels[name].Set(v)
+	}
+
+	slog.SetDefault(For(""))
+
+	return nil
+}
+
+// For returns a logger of a given subsystem
+func For(subsystem string) *slog.Logger {
+	return slog.New(&subsystemHandler{subsystem: subsystem})
+}
+
+// subsystemHandler filters records by the subsystem level and passes them to
+// the current base handler
+type subsystemHandler struct {
+	subsystem string
+	with      []func(slog.Handler) slog.Handler
+}
+
+func (h *subsystemHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= levels[h.subsystem].Level()
+}
+
+func (h *subsystemHandler) Handle(ctx context.Context, r slog.Record) error {
+	handler := *base.Load()
+	if h.subsystem != "" {
+		handler = handler.WithAttrs([]slog.Attr{slog.String("subsystem", h.subsystem)})
+	}
+	for _, f := range h.with {
+		handler = f(handler)
+	}
+	return handler.Handle(ctx, r)
+}
+
+func (h *subsystemHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.chain(func(v slog.Handler) slog.Handler {
+		return v.WithAttrs(attrs)
+	})
+}
+
+func (h *subsystemHandler) WithGroup(name string) slog.Handler {
+	return h.chain(func(v slog.Handler) slog.Handler {
+		return v.WithGroup(name)
+	})
+}
+
+func (h *subsystemHandler) chain(f func(slog.Handler) slog.Handler) slog.Handler {
+	with := append(h.with[:len(h.with):len(h.with)], f)
+	return &subsystemHandler{subsystem: h.subsystem, with: with}
+}
@@ -0,0 +1,55 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	for in, expected := range map[string]string{
+		"username=user&password=secret&vhost=standard": "username=user&password=<redacted>&vhost=standard",
+		"Cookie: MRHSession=abc; F5_ST=1":              "Cookie: <redacted>",
+		"https://vpn/myvpn?sess=abc&hostname=x&Z=123":  "https://vpn/myvpn?sess=<redacted>&hostname=x&Z=<redacted>",
+		"X-Access-Session-Id: abc":                     "X-Access-Session-Id: <redacted>",
+		"<Session_ID>abc</Session_ID><ur_Z>1</ur_Z>":   "<Session_ID><redacted></Session_ID><ur_Z><redacted></ur_Z>",
+		"Using interface ppp0":                         "Using interface ppp0",
+	} {
+		if v := Redact(in); v != expected {
+			t.Errorf("unexpected %q redaction: %q, expected: %q", in, v, expected)
+		}
+	}
+}
+
+func TestSetup(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := Setup(buf, "json", "warn,http=debug", false); err != nil {
+		t.Fatal(err)
+	}
+	defer Setup(&bytes.Buffer{}, "", "", false)
+
+	For(HTTP).Debug("request", "password", "secret")
+	For(PPP).Info("skipped")
+	slog.Warn("sent", "url", "https://vpn/?sess=abc")
+	u, _ := url.Parse("https://vpn/my.policy?sess=def")
+	slog.Warn("redirected", "location", u)
+
+	out := buf.String()
+	for _, v := range []string{`"subsystem":"http"`, `"password":"<redacted>"`, `"url":"https://vpn/?sess=<redacted>"`, `"location":"https://vpn/my.policy?sess=<redacted>"`} {
+		if !strings.Contains(out, v) {
+			t.Errorf("%s is missing in:\n%s", v, out)
+		}
+	}
+	if strings.Contains(out, "secret") || strings.Contains(out, "def") || strings.Contains(out, "skipped") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+
+	if err := Setup(buf, "xml", "", false); err == nil {
+		t.Errorf("unsupported format must return an error")
+	}
+	if _, err := ParseLevels("info,tun=debug", false); err == nil {
+		t.Errorf("unknown subsystem must return an error")
+	}
+}
@@ -0,0 +1,112 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const redacted = "<redacted>"
+
+var (
+	// attribute keys, which values are always redacted
+	secretKeys = map[string]bool{
+		"password":      true,
+		"sessionid":     true,
+		"session":       true,
+		"token":         true,
+		"cookie":        true,
+		"cookies":       true,
+		"authorization": true,
+	}
+
+	secretPatterns = []struct {
+		re   *regexp.Regexp
+		repl string
+	}{
+		// form values, URL query parameters and cookies,
+		// e.g. "password=...", "sess=...", "MRHSession=..."
+		{regexp.MustCompile(`(?i)\b((?:password|passwd|token|otc|sess|session_?id|z|mrhsession|[a-z_]*sessid[a-z_]*)=)[^&;\s"]+`), "${1}" + redacted},
+		// HTTP headers
+		{regexp.MustCompile(`(?im)^((?:cookie|set-cookie|authorization|x-access-session-id|x-access-session-token):\s*).*$`), "${1}" + redacted},
+		// F5 XML responses
+		{regexp.MustCompile(`(?i)(<(?:session_id|ur_z)>)[^<]*`), "${1}" + redacted},
+		// JSON values
+		{regexp.MustCompile(`(?i)("(?:password|token|session_?id)"\s*:\s*")[^"]*`), "${1}" + redacted},
+	}
+)
+
+// Redact replaces passwords, session IDs, tokens and cookies in a string
+func Redact(s string) string {
+	for _, p := range secretPatterns {
+		s = p.re.ReplaceAllString(s, p.repl)
+	}
+	return s
+}
+
+func redactAttr(a slog.Attr) slog.Attr {
+	if secretKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, redacted)
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Redact(a.Value.String()))
+	case slog.KindGroup:
+		attrs := a.Value.Group()
+		res := make([]any, len(attrs))
+		for i, v := range attrs {
+			res[i] = redactAttr(v)
+		}
+		return slog.Group(a.Key, res...)
+	case slog.KindAny, slog.KindLogValuer:
+		v := a.Value.Resolve()
+		if v.Kind() != slog.KindAny {
+			return redactAttr(slog.Attr{Key: a.Key, Value: v})
+		}
+		if err, ok := v.Any().(error); ok {
+			return slog.String(a.Key, Redact(err.Error()))
+		}
+		// e.g. *url.URL, other values keep their type, unless they contain
+		// secrets
+		s := fmt.Sprint(v.Any())
+		if r := Redact(s); r != s {
+			return slog.String(a.Key, r)
+		}
+		if _, ok := v.Any().(fmt.Stringer); ok {
+			return slog.String(a.Key, s)
+		}
+	}
+	return a
+}
+
+// redactHandler removes secrets from the messages and attributes
+type redactHandler struct {
+	inner slog.Handler
+}
+
+func (h *redactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *redactHandler) Handle(ctx context.Context, r slog.Record) error {
+	nr := slog.NewRecord(r.Time, r.Level, Redact(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		nr.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.inner.Handle(ctx, nr)
+}
+
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	res := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		res[i] = redactAttr(a)
+	}
+	return &redactHandler{inner: h.inner.WithAttrs(res)}
+}
+
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{inner: h.inner.WithGroup(name)}
+}
@@ -0,0 +1,167 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// traffic directions
+const (
+	In  = "in"
+	Out = "out"
+)
+
+var (
+	bytesIn             atomic.Uint64
+	bytesOut            atomic.Uint64
+	packetsIn           atomic.Uint64
+	packetsOut          atomic.Uint64
+	reconnects          atomic.Uint64
+	dnsQueries          atomic.Uint64
+	dnsUpstreamFailures atomic.Uint64
+	// nanoseconds
+	lcpEchoRTT atomic.Int64
+
+	session struct {
+		sync.Mutex
+		start     time.Time
+		transport string
+	}
+)
+
+// AddPacket counts a packet of n bytes in a given direction
+func AddPacket(direction string, n int) {
+	AddBytes(direction, n)
+	if direction == In {
+		packetsIn.Add(1)
+		return
+	}
+	packetsOut.Add(1)
+}
+
+// AddBytes counts n bytes in a given direction, it is used for streams,
+// where packet boundaries are unknown, e.g. with the pppd driver
+func AddBytes(direction string, n int) {
+	if direction == In {
+		bytesIn.Add(uint64(n))
+		return
+	}
+	bytesOut.Add(uint64(n))
+}
+
+func IncReconnects() {
+	reconnects.Add(1)
+}
+
+func IncDNSQueries() {
+	dnsQueries.Add(1)
+}
+
+func IncDNSUpstreamFailures() {
+	dnsUpstreamFailures.Add(1)
+}
+
+func SetLCPEchoRTT(d time.Duration) {
+	lcpEchoRTT.Store(int64(d))
+}
+
+// SessionUp marks the tunnel as established using a given transport, i.e.
+// "tls" or "dtls"
+func SessionUp(transport string) {
+	session.Lock()
+	defer session.Unlock()
+	session.start = time.Now()
+	session.transport = transport
+}
+
+// SessionDown marks the tunnel as down
+func SessionDown() {
+	session.Lock()
+	defer session.Unlock()
+	session.start = time.Time{}
+	session.transport = ""
+	lcpEchoRTT.Store(0)
+}
+
+func write(w io.Writer, name, typ, help string, values ...string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	for _, v := range values {
+		fmt.Fprintf(w, "%s%s\n", name, v)
+	}
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format
+func WriteTo(w io.Writer) {
+	write(w, "gof5_tunnel_bytes_total", "counter", "Tunnel traffic in bytes.",
+		fmt.Sprintf(`{direction=%q} %d`, In, bytesIn.Load()),
+		fmt.Sprintf(`{direction=%q} %d`, Out, bytesOut.Load()),
+	)
+	write(w, "gof5_tunnel_packets_total", "counter", "Tunnel traffic in packets.",
+		fmt.Sprintf(`{direction=%q} %d`, In, packetsIn.Load()),
+		fmt.Sprintf(`{direction=%q} %d`, Out, packetsOut.Load()),
+	)
+	write(w, "gof5_lcp_echo_rtt_seconds", "gauge", "The last LCP echo round-trip time.",
+		fmt.Sprintf(" %g", time.Duration(lcpEchoRTT.Load()).Seconds()),
+	)
+	write(w, "gof5_reconnects_total", "counter", "Number of tunnel reconnects.",
+		fmt.Sprintf(" %d", reconnects.Load()),
+	)
+	write(w, "gof5_dns_queries_total", "counter", "Number of DNS proxy queries.",
+		fmt.Sprintf(" %d", dnsQueries.Load()),
+	)
+	write(w, "gof5_dns_upstream_failures_total", "counter", "Number of failed DNS proxy upstream queries.",
+		fmt.Sprintf(" %d", dnsUpstreamFailures.Load()),
+	)
+
+	session.Lock()
+	var uptime float64
+	if !session.start.IsZero() {
+		uptime = time.Since(session.start).Seconds()
+	}
+	transport := session.transport
+	session.Unlock()
+
+	write(w, "gof5_session_uptime_seconds", "gauge", "Current tunnel session uptime.",
+		fmt.Sprintf(" %g", uptime),
+	)
+	var tls, dtls int
+	switch transport {
+	case "tls":
+		tls = 1
+	case "dtls":
+		dtls = 1
+	}
+	write(w, "gof5_transport", "gauge", "Current tunnel transport.",
+		fmt.Sprintf(`{transport="tls"} %d`, tls),
+		fmt.Sprintf(`{transport="dtls"} %d`, dtls),
+	)
+}
+
+// Serve starts the metrics listener
+func Serve(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to start metrics listener: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteTo(w)
+	})
+
+	slog.Info("Serving metrics", "url", fmt.Sprintf("http://%s/metrics", ln.Addr()))
+	go func() {
+		if err := http.Serve(ln, mux); err != nil {
+			slog.Error("Metrics listener failed", "err", err)
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	AddPacket(In, 100)
+	AddPacket(Out, 40)
+	AddBytes(Out, 2)
+	SessionUp("dtls")
+
+	buf := &bytes.Buffer{}
+	WriteTo(buf)
+	out := buf.String()
+
+	for _, v := range []string{
+		`gof5_tunnel_bytes_total{direction="in"} 100`,
+		`gof5_tunnel_bytes_total{direction="out"} 42`,
+		`gof5_tunnel_packets_total{direction="out"} 1`,
+		`gof5_transport{transport="dtls"} 1`,
+		`gof5_transport{transport="tls"} 0`,
+		"# TYPE gof5_reconnects_total counter",
+	} {
+		if !strings.Contains(out, v) {
+			t.Errorf("%q is missing in:\n%s", v, out)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// link types, see https://www.tcpdump.org/linktypes.html
+const (
+	// PPP frames, starting with the PPP protocol field or 0xff 0x03
+	LinkTypePPP = 9
+	// raw IPv4 or IPv6 packets
+	LinkTypeRaw = 101
+)
+
+const (
+	snapLen = 65535
+
+	// pcapng block types
+	sectionHeaderBlock  = 0x0a0d0d0a
+	interfaceDescBlock  = 0x00000001
+	enhancedPacketBlock = 0x00000006
+	byteOrderMagic      = 0x1a2b3c4d
+
+	// pcapng option codes
+	optEnd     = 0
+	optIfName  = 2
+	optEPBFlag = 2
+
+	// classic pcap magic, microsecond timestamps
+	pcapMagic = 0xa1b2c3d4
+)
+
+var order = binary.LittleEndian
+
+// Interface describes a capture interface
+type Interface struct {
+	Name     string
+	LinkType uint16
+}
+
+// Writer writes packets into a pcapng file or a classic pcap file, when the
+// file name has the .pcap extension. Classic pcap supports only a single
+// interface.
+type Writer struct {
+	sync.Mutex
+	f          *os.File
+	ng         bool
+	interfaces int
+	err        error
+}
+
+// Create creates a capture file with a given list of interfaces, the
+// interface index is used in WritePacket
+func Create(path string, interfaces ...Interface) (*Writer, error) {
+	w := &Writer{
+		ng:         !strings.EqualFold(filepath.Ext(path), ".pcap"),
+		interfaces: len(interfaces),
+	}
+	if !w.ng && len(interfaces) > 1 {
+		return nil, fmt.Errorf("pcap format supports only one interface, use pcapng")
+	}
+
+	buf := &bytes.Buffer{}
+	if w.ng {
+		writeBlock(buf, sectionHeaderBlock, func(b *bytes.Buffer) {
+			binary.Write(b, order, uint32(byteOrderMagic))
+			// version 1.0
+			binary.Write(b, order, uint16(1))
+			binary.Write(b, order, uint16(0))
+			// unknown section length
+			binary.Write(b, order, int64(-1))
+		})
+		for _, v := range interfaces {
+			writeBlock(buf, interfaceDescBlock, func(b *bytes.Buffer) {
+				binary.Write(b, order, v.LinkType)
+				// reserved
+				binary.Write(b, order, uint16(0))
+				binary.Write(b, order, uint32(snapLen))
+				writeOption(b, optIfName, []byte(v.Name))
+				writeOption(b, optEnd, nil)
+			})
+		}
+	} else {
+		binary.Write(buf, order, uint32(pcapMagic))
+		// version 2.4
+		binary.Write(buf, order, uint16(2))
+		binary.Write(buf, order, uint16(4))
+		// timezone and timestamp accuracy
+		binary.Write(buf, order, int32(0))
+		binary.Write(buf, order, uint32(0))
+		binary.Write(buf, order, uint32(snapLen))
+		var linkType uint16 = LinkTypeRaw
+		if len(interfaces) > 0 {
+			linkType = interfaces[0].LinkType
+		}
+		binary.Write(buf, order, uint32(linkType))
+	}
+
+	var err error
+	w.f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create capture file: %v", err)
+	}
+	if _, err = w.f.Write(buf.Bytes()); err != nil {
+		w.f.Close()
+		return nil, fmt.Errorf("failed to write capture file header: %v", err)
+	}
+
+	return w, nil
+}
+
+func pad(n int) int {
+	return (4 - n%4) % 4
+}
+
+func writeOption(b *bytes.Buffer, code uint16, v []byte) {
+	binary.Write(b, order, code)
+	binary.Write(b, order, uint16(len(v)))
+	b.Write(v)
+	b.Write(make([]byte, pad(len(v))))
+}
+
+// writeBlock writes a pcapng block, the block total length is written before
+// and after the body
+func writeBlock(buf *bytes.Buffer, typ uint32, body func(*bytes.Buffer)) {
+	b := &bytes.Buffer{}
+	body(b)
+	length := uint32(b.Len() + 12)
+	binary.Write(buf, order, typ)
+	binary.Write(buf, order, length)
+	buf.Write(b.Bytes())
+	binary.Write(buf, order, length)
+}
+
+// WritePacket writes a packet captured on a given interface, write errors are
+// logged once and further packets are ignored
+func (w *Writer) WritePacket(iface int, inbound bool, data []byte) {
+	if w == nil || iface >= w.interfaces {
+		return
+	}
+
+	now := time.Now()
+	caplen := len(data)
+	if caplen > snapLen {
+		caplen = snapLen
+	}
+
+	buf := &bytes.Buffer{}
+	if w.ng {
+		writeBlock(buf, enhancedPacketBlock, func(b *bytes.Buffer) {
+			ts := uint64(now.UnixMicro())
+			binary.Write(b, order, uint32(iface))
+			binary.Write(b, order, uint32(ts>>32))
+			binary.Write(b, order, uint32(ts))
+			binary.Write(b, order, uint32(caplen))
+			binary.Write(b, order, uint32(len(data)))
+			b.Write(data[:caplen])
+			b.Write(make([]byte, pad(caplen)))
+			// packet direction
+			flags := make([]byte, 4)
+			if inbound {
+				order.PutUint32(flags, 1)
+			} else {
+				order.PutUint32(flags, 2)
+			}
+			writeOption(b, optEPBFlag, flags)
+			writeOption(b, optEnd, nil)
+		})
+	} else {
+		binary.Write(buf, order, uint32(now.Unix()))
+		binary.Write(buf, order, uint32(now.Nanosecond()/1000))
+		binary.Write(buf, order, uint32(caplen))
+		binary.Write(buf, order, uint32(len(data)))
+		buf.Write(data[:caplen])
+	}
+
+	w.Lock()
+	defer w.Unlock()
+
+	if w.err != nil {
+		return
+	}
+	if _, w.err = w.f.Write(buf.Bytes()); w.err != nil {
+		slog.Error("Failed to write capture file, stopping capture", "err", w.err)
+	}
+}
+
+// Close closes the capture file
+func (w *Writer) Close() error {
+	if w == nil {
+		return nil
+	}
+	w.Lock()
+	defer w.Unlock()
+	return w.f.Close()
+}
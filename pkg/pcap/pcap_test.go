@@ -0,0 +1,62 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.pcapng")
+	w, err := Create(path,
+		Interface{Name: "tun", LinkType: LinkTypeRaw},
+		Interface{Name: "f5", LinkType: LinkTypePPP},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WritePacket(0, true, []byte{0x45, 0x00, 0x00})
+	w.WritePacket(1, false, []byte{0xff, 0x03, 0xc0, 0x21, 0x09})
+	// unknown interface is ignored
+	w.WritePacket(2, false, []byte{0x00})
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var types []uint32
+	for len(raw) > 0 {
+		if len(raw) < 12 {
+			t.Fatalf("truncated block: %x", raw)
+		}
+		typ := binary.LittleEndian.Uint32(raw)
+		length := binary.LittleEndian.Uint32(raw[4:])
+		if length%4 != 0 || int(length) > len(raw) {
+			t.Fatalf("invalid %x block length: %d", typ, length)
+		}
+		if v := binary.LittleEndian.Uint32(raw[length-4:]); v != length {
+			t.Fatalf("trailing %x block length mismatch: %d != %d", typ, v, length)
+		}
+		types = append(types, typ)
+		raw = raw[length:]
+	}
+
+	expected := []uint32{sectionHeaderBlock, interfaceDescBlock, interfaceDescBlock, enhancedPacketBlock, enhancedPacketBlock}
+	if len(types) != len(expected) {
+		t.Fatalf("unexpected blocks: %x", types)
+	}
+	for i := range expected {
+		if types[i] != expected[i] {
+			t.Errorf("unexpected blocks: %x", types)
+		}
+	}
+
+	if _, err = Create(filepath.Join(t.TempDir(), "test.pcap"), Interface{}, Interface{}); err == nil {
+		t.Errorf("pcap with multiple interfaces must return an error")
+	}
+}
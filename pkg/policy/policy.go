@@ -0,0 +1,55 @@
+package policy
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/kayrus/gof5/pkg/logging"
+)
+
+// rule modes, which select the traffic routed via the VPN table
+const (
+	// all traffic, which matches the VPN table routes
+	Destination = "destination"
+	// traffic from the VPN interface addresses
+	Source = "source"
+	// traffic with the VPN mark
+	Fwmark = "fwmark"
+)
+
+const (
+	// DefaultExcludeMark marks the F5 server connection, its traffic always
+	// uses the main table
+	DefaultExcludeMark = 0xf5
+	// rule priorities, the exclusion rule must precede the VPN rule
+	excludePriority = 5208
+	vpnPriority     = 5209
+)
+
+var routeLog = logging.For(logging.Route)
+
+// Modes are the supported rule modes
+var Modes = []string{Destination, Source, Fwmark}
+
+// Rules describe the policy routing rules, which direct the traffic into the
+// dedicated VPN routing table
+type Rules struct {
+	Table int
+	Mode  string
+	// VPN traffic mark, used in the fwmark mode
+	Mark int
+	// F5 server connection mark
+	ExcludeMark int
+	// VPN interface addresses, used in the source mode
+	Sources []net.IP
+}
+
+func (r Rules) String() string {
+	switch r.Mode {
+	case Source:
+		return fmt.Sprintf("from %s lookup %d", r.Sources, r.Table)
+	case Fwmark:
+		return fmt.Sprintf("fwmark %#x lookup %d", r.Mark, r.Table)
+	}
+	return fmt.Sprintf("lookup %d", r.Table)
+}
@@ -0,0 +1,146 @@
+//go:build linux
+// +build linux
+
+package policy
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// rules returns the netlink rules for both address families
+func (r Rules) rules() []*netlink.Rule {
+	var res []*netlink.Rule
+	for _, family := range []int{unix.AF_INET, unix.AF_INET6} {
+		if r.ExcludeMark > 0 {
+			v := netlink.NewRule()
+			v.Family = family
+			v.Priority = excludePriority
+			v.Mark = r.ExcludeMark
+			v.Table = unix.RT_TABLE_MAIN
+			res = append(res, v)
+		}
+
+		switch r.Mode {
+		case Source:
+			for _, ip := range r.Sources {
+				bits := 128
+				if v := ip.To4(); v != nil {
+					ip, bits = v, 32
+				}
+				if (bits == 32) != (family == unix.AF_INET) {
+					continue
+				}
+				v := netlink.NewRule()
+				v.Family = family
+				v.Priority = vpnPriority
+				v.Src = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+				v.Table = r.Table
+				res = append(res, v)
+			}
+		case Fwmark:
+			v := netlink.NewRule()
+			v.Family = family
+			v.Priority = vpnPriority
+			v.Mark = r.Mark
+			v.Table = r.Table
+			res = append(res, v)
+		default:
+			v := netlink.NewRule()
+			v.Family = family
+			v.Priority = vpnPriority
+			v.Table = r.Table
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// Set adds the rules, the existing identical rules are kept
+func (r Rules) Set() error {
+	for _, v := range r.rules() {
+		if err := netlink.RuleAdd(v); err != nil && err != unix.EEXIST {
+			return fmt.Errorf("failed to add %q rule: %s", v, err)
+		}
+	}
+	return nil
+}
+
+// Remove deletes the rules, the missing rules are ignored
+func (r Rules) Remove() error {
+	var err error
+	for _, v := range r.rules() {
+		if e := netlink.RuleDel(v); e != nil && e != unix.ENOENT {
+			err = fmt.Errorf("failed to delete %q rule: %s", v, e)
+		}
+	}
+	return err
+}
+
+// Control returns the dialer control function, which sets the socket mark
+func Control(mark int) func(network, address string, c syscall.RawConn) error {
+	return func(_, _ string, c syscall.RawConn) error {
+		var err error
+		e := c.Control(func(fd uintptr) {
+			err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_MARK, mark)
+		})
+		if e != nil {
+			return e
+		}
+		if err != nil {
+			return fmt.Errorf("failed to set %#x socket mark: %s", mark, err)
+		}
+		return nil
+	}
+}
+
+// Router adds and removes the routes in the dedicated routing table
+type Router struct {
+	iface  *net.Interface
+	routes []*net.IPNet
+	table  int
+	metric int
+}
+
+// NewRouter returns the routes handler of the routing table
+func NewRouter(name string, routes []*net.IPNet, table, metric int) (*Router, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %q interface: %s", name, err)
+	}
+	return &Router{
+		iface:  iface,
+		routes: routes,
+		table:  table,
+		metric: metric,
+	}, nil
+}
+
+func (h *Router) route(dst *net.IPNet) *netlink.Route {
+	return &netlink.Route{
+		LinkIndex: h.iface.Index,
+		Dst:       dst,
+		Priority:  h.metric,
+		Table:     h.table,
+	}
+}
+
+func (h *Router) Add() {
+	for _, dst := range h.routes {
+		if err := netlink.RouteReplace(h.route(dst)); err != nil {
+			routeLog.Error("Failed to add route", "route", dst, "table", h.table, "err", err)
+		}
+	}
+}
+
+func (h *Router) Del() {
+	for _, dst := range h.routes {
+		if err := netlink.RouteDel(h.route(dst)); err != nil {
+			routeLog.Error("Failed to delete route", "route", dst, "table", h.table, "err", err)
+		}
+	}
+}
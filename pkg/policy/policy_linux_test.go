@@ -0,0 +1,153 @@
+//go:build linux
+// +build linux
+
+package policy
+
+import (
+	"net"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+)
+
+// isolate runs the test in a new network namespace, bound to the test
+// goroutine thread
+func isolate(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root")
+	}
+
+	runtime.LockOSThread()
+	origin, err := netns.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns, err := netns.New()
+	if err != nil {
+		origin.Close()
+		t.Skipf("cannot create network namespace: %s", err)
+	}
+	t.Cleanup(func() {
+		ns.Close()
+		if err := netns.Set(origin); err == nil {
+			runtime.UnlockOSThread()
+		}
+		origin.Close()
+	})
+}
+
+func findRules(t *testing.T, family, priority int) []netlink.Rule {
+	rules, err := netlink.RuleList(family)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res []netlink.Rule
+	for _, v := range rules {
+		if v.Priority == priority {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+func TestRules(t *testing.T) {
+	isolate(t)
+
+	r := Rules{
+		Table:       100,
+		Mode:        Fwmark,
+		Mark:        0x100,
+		ExcludeMark: DefaultExcludeMark,
+	}
+	if err := r.Set(); err != nil {
+		t.Fatal(err)
+	}
+	// idempotent
+	if err := r.Set(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, family := range []int{unix.AF_INET, unix.AF_INET6} {
+		v := findRules(t, family, vpnPriority)
+		if len(v) != 1 || v[0].Table != 100 || v[0].Mark != 0x100 {
+			t.Errorf("unexpected VPN rules: %v", v)
+		}
+		v = findRules(t, family, excludePriority)
+		if len(v) != 1 || v[0].Table != unix.RT_TABLE_MAIN || v[0].Mark != DefaultExcludeMark {
+			t.Errorf("unexpected exclusion rules: %v", v)
+		}
+	}
+
+	if err := r.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if v := findRules(t, unix.AF_INET, vpnPriority); len(v) != 0 {
+		t.Errorf("rules are not removed: %v", v)
+	}
+
+	// source mode
+	r = Rules{
+		Table:   100,
+		Mode:    Source,
+		Sources: []net.IP{net.IPv4(172, 16, 0, 2)},
+	}
+	if err := r.Set(); err != nil {
+		t.Fatal(err)
+	}
+	v := findRules(t, unix.AF_INET, vpnPriority)
+	if len(v) != 1 || v[0].Src == nil || v[0].Src.String() != "172.16.0.2/32" {
+		t.Errorf("unexpected source rules: %v", v)
+	}
+	if v := findRules(t, unix.AF_INET6, vpnPriority); len(v) != 0 {
+		t.Errorf("unexpected IPv6 source rules: %v", v)
+	}
+	if err := r.Remove(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRouter(t *testing.T) {
+	isolate(t)
+
+	link := &netlink.Tuntap{
+		LinkAttrs: netlink.LinkAttrs{Name: "gof5test"},
+		Mode:      netlink.TUNTAP_MODE_TUN,
+	}
+	if err := netlink.LinkAdd(link); err != nil {
+		t.Skipf("cannot create TUN interface: %s", err)
+	}
+	defer netlink.LinkDel(link)
+	if err := netlink.LinkSetUp(link); err != nil {
+		t.Fatal(err)
+	}
+
+	_, dst, _ := net.ParseCIDR("10.11.0.0/16")
+	h, err := NewRouter("gof5test", []*net.IPNet{dst}, 100, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Add()
+
+	filter := &netlink.Route{Table: 100}
+	routes, err := netlink.RouteListFiltered(unix.AF_INET, filter, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 1 || routes[0].Dst.String() != "10.11.0.0/16" || routes[0].Priority != 50 {
+		t.Errorf("unexpected table routes: %v", routes)
+	}
+	main, _ := netlink.RouteListFiltered(unix.AF_INET, &netlink.Route{Dst: dst}, netlink.RT_FILTER_DST)
+	if len(main) != 0 {
+		t.Errorf("route is added into the main table: %v", main)
+	}
+
+	h.Del()
+	routes, _ = netlink.RouteListFiltered(unix.AF_INET, filter, netlink.RT_FILTER_TABLE)
+	if len(routes) != 0 {
+		t.Errorf("routes are not removed: %v", routes)
+	}
+}
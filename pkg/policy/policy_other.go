@@ -0,0 +1,32 @@
+//go:build !linux
+// +build !linux
+
+package policy
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+func (r Rules) Set() error {
+	return fmt.Errorf("policy routing is supported only in Linux")
+}
+
+func (r Rules) Remove() error {
+	return nil
+}
+
+func Control(_ int) func(network, address string, c syscall.RawConn) error {
+	return nil
+}
+
+type Router struct{}
+
+func NewRouter(_ string, _ []*net.IPNet, _, _ int) (*Router, error) {
+	return nil, fmt.Errorf("policy routing is supported only in Linux")
+}
+
+func (h *Router) Add() {}
+
+func (h *Router) Del() {}